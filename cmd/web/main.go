@@ -1,20 +1,125 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/asim/go-micro/v3"
+	"github.com/asim/go-micro/v3/selector"
 
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
 	"github.com/Mikhalevich/filesharing-web-service/internal/handler"
+	"github.com/Mikhalevich/filesharing-web-service/internal/oidc"
 	"github.com/Mikhalevich/filesharing-web-service/internal/router"
 	"github.com/Mikhalevich/filesharing-web-service/internal/wrapper"
 	"github.com/Mikhalevich/filesharing/pkg/service"
 )
 
+const (
+	sessionStoreCookie = "cookie"
+	sessionStoreMemory = "memory"
+	sessionStoreFile   = "file"
+
+	apiTokenStoreNone   = "none"
+	apiTokenStoreMemory = "memory"
+	apiTokenStoreFile   = "file"
+
+	shareLinkStoreNone   = "none"
+	shareLinkStoreMemory = "memory"
+	shareLinkStoreFile   = "file"
+)
+
 type config struct {
-	service.Config           `yaml:"service"`
-	GatewayHost              string `yaml:"gateway_host"`
-	SessionExpirePeriodInSec int    `yaml:"session_expire_period"`
+	service.Config             `yaml:"service"`
+	GatewayHost                string     `yaml:"gateway_host"`
+	GatewayService             string     `yaml:"gateway_service"`
+	GatewayTimeoutInSec        int        `yaml:"gateway_timeout"`
+	GatewayRetries             int        `yaml:"gateway_retries"`
+	GatewayMaxIdleConns        int        `yaml:"gateway_max_idle_conns"`
+	BreakerThreshold           int        `yaml:"breaker_threshold"`
+	BreakerTimeoutInSec        int        `yaml:"breaker_timeout"`
+	ListCacheTTLInSec          int        `yaml:"list_cache_ttl"`
+	SessionExpirePeriodInSec   int        `yaml:"session_expire_period"`
+	SessionMaxLifetimeInSec    int        `yaml:"session_max_lifetime"`
+	RememberMePeriodInSec      int        `yaml:"remember_me_period"`
+	RememberMeMaxLifetimeInSec int        `yaml:"remember_me_max_lifetime"`
+	TokenRefreshBeforeInSec    int        `yaml:"token_refresh_before"`
+	PublicStorages             []string   `yaml:"public_storages"`
+	CookieKeys                 []string   `yaml:"cookie_keys"`
+	CookiePrefix               string     `yaml:"cookie_prefix"`
+	CookieDomain               string     `yaml:"cookie_domain"`
+	CookieSecure               bool       `yaml:"cookie_secure"`
+	CookieSameSite             string     `yaml:"cookie_same_site"`
+	SessionStore               string     `yaml:"session_store"`
+	SessionFile                string     `yaml:"session_file"`
+	AdminToken                 string     `yaml:"admin_token"`
+	LoginAttemptsPerMinute     int        `yaml:"login_attempts_per_minute"`
+	LoginLockoutThreshold      int        `yaml:"login_lockout_threshold"`
+	LoginLockoutInSec          int        `yaml:"login_lockout"`
+	LoginLockoutMaxInSec       int        `yaml:"login_lockout_max"`
+	TrustedProxies             []string   `yaml:"trusted_proxies"`
+	PasswordMinLength          int        `yaml:"password_min_length"`
+	PasswordMinClasses         int        `yaml:"password_min_classes"`
+	APITokenStore              string     `yaml:"api_token_store"`
+	APITokenFile               string     `yaml:"api_token_file"`
+	ShareLinkStore             string     `yaml:"share_link_store"`
+	ShareLinkFile              string     `yaml:"share_link_file"`
+	ShareLinkMaxTTLInSec       int        `yaml:"share_link_max_ttl"`
+	OIDC                       oidcConfig `yaml:"oidc"`
+}
+
+// oidcConfig configures single sign on, it is disabled while issuer is empty
+type oidcConfig struct {
+	Issuer       string          `yaml:"issuer"`
+	ClientID     string          `yaml:"client_id"`
+	ClientSecret string          `yaml:"client_secret"`
+	RedirectURL  string          `yaml:"redirect_url"`
+	Scopes       []string        `yaml:"scopes"`
+	GroupsClaim  string          `yaml:"groups_claim"`
+	TimeoutInSec int             `yaml:"timeout"`
+	ACL          []oidcACLConfig `yaml:"acl"`
+}
+
+type oidcACLConfig struct {
+	Storage string   `yaml:"storage"`
+	Emails  []string `yaml:"emails"`
+	Groups  []string `yaml:"groups"`
+}
+
+func (c oidcConfig) enabled() bool {
+	return c.Issuer != ""
+}
+
+// cookieKeys decodes base64 cookie secrets, the first one is current, others are kept for rotation
+func (c *config) cookieKeys() ([][]byte, error) {
+	keys := make([][]byte, 0, len(c.CookieKeys))
+	for i, k := range c.CookieKeys {
+		key, err := base64.StdEncoding.DecodeString(k)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cookie_keys[%d]: %w", i, err)
+		}
+
+		if len(key) < wrapper.MinCookieKeyLength {
+			return nil, fmt.Errorf("cookie_keys[%d] should be at least %d bytes", i, wrapper.MinCookieKeyLength)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// generateCookieKey makes temporary cookie secret for deployments without cookie_keys
+func generateCookieKey() ([]byte, error) {
+	key := make([]byte, wrapper.MinCookieKeyLength)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("random: %w", err)
+	}
+	return key, nil
 }
 
 func (c *config) Service() service.Config {
@@ -22,24 +127,353 @@ func (c *config) Service() service.Config {
 }
 
 func (c *config) Validate() error {
-	if c.GatewayHost == "" {
-		return errors.New("gateway_host is required")
+	if c.GatewayHost == "" && c.GatewayService == "" {
+		return errors.New("gateway_host or gateway_service is required")
+	}
+
+	if c.GatewayTimeoutInSec <= 0 {
+		return errors.New("invalid gateway_timeout")
+	}
+
+	if c.GatewayRetries < 0 {
+		return errors.New("invalid gateway_retries")
+	}
+
+	if c.GatewayMaxIdleConns <= 0 {
+		return errors.New("invalid gateway_max_idle_conns")
+	}
+
+	if c.BreakerThreshold <= 0 {
+		return errors.New("invalid breaker_threshold")
+	}
+
+	if c.BreakerTimeoutInSec <= 0 {
+		return errors.New("invalid breaker_timeout")
+	}
+
+	if c.ListCacheTTLInSec < 0 {
+		return errors.New("invalid list_cache_ttl")
 	}
 
 	if c.SessionExpirePeriodInSec <= 0 {
 		return errors.New("invalid session_expire_period")
 	}
 
+	if c.SessionMaxLifetimeInSec < c.SessionExpirePeriodInSec {
+		return errors.New("session_max_lifetime should not be less than session_expire_period")
+	}
+
+	if c.RememberMePeriodInSec <= 0 {
+		return errors.New("invalid remember_me_period")
+	}
+
+	if c.RememberMeMaxLifetimeInSec < c.RememberMePeriodInSec {
+		return errors.New("remember_me_max_lifetime should not be less than remember_me_period")
+	}
+
+	if c.TokenRefreshBeforeInSec < 0 {
+		return errors.New("invalid token_refresh_before")
+	}
+
+	if _, err := c.cookieKeys(); err != nil {
+		return err
+	}
+
+	if c.CookiePrefix == "" {
+		return errors.New("cookie_prefix is required")
+	}
+
+	sameSite, err := wrapper.ParseSameSite(c.CookieSameSite)
+	if err != nil {
+		return fmt.Errorf("invalid cookie_same_site: %w", err)
+	}
+
+	if sameSite == http.SameSiteNoneMode && !c.CookieSecure {
+		return errors.New("cookie_same_site none requires cookie_secure")
+	}
+
+	if c.LoginAttemptsPerMinute <= 0 {
+		return errors.New("invalid login_attempts_per_minute")
+	}
+
+	if c.LoginLockoutThreshold <= 0 {
+		return errors.New("invalid login_lockout_threshold")
+	}
+
+	if c.LoginLockoutInSec <= 0 || c.LoginLockoutMaxInSec < c.LoginLockoutInSec {
+		return errors.New("invalid login_lockout or login_lockout_max")
+	}
+
+	if c.PasswordMinLength <= 0 {
+		return errors.New("invalid password_min_length")
+	}
+
+	if c.PasswordMinClasses < 0 || c.PasswordMinClasses > 4 {
+		return errors.New("password_min_classes should be from 0 to 4")
+	}
+
+	if _, err := handler.ParseTrustedProxies(c.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid trusted_proxies: %w", err)
+	}
+
+	if c.OIDC.enabled() {
+		if c.OIDC.ClientID == "" || c.OIDC.RedirectURL == "" {
+			return errors.New("oidc client_id and redirect_url are required")
+		}
+
+		if c.OIDC.TimeoutInSec <= 0 {
+			return errors.New("invalid oidc timeout")
+		}
+
+		for i, rule := range c.OIDC.ACL {
+			if rule.Storage == "" {
+				return fmt.Errorf("oidc acl[%d] storage is required", i)
+			}
+		}
+	}
+
+	switch c.APITokenStore {
+	case apiTokenStoreNone, apiTokenStoreMemory:
+	case apiTokenStoreFile:
+		if c.APITokenFile == "" {
+			return errors.New("api_token_file is required for file api_token_store")
+		}
+	default:
+		return fmt.Errorf("invalid api_token_store: %s", c.APITokenStore)
+	}
+
+	switch c.ShareLinkStore {
+	case shareLinkStoreNone, shareLinkStoreMemory:
+	case shareLinkStoreFile:
+		if c.ShareLinkFile == "" {
+			return errors.New("share_link_file is required for file share_link_store")
+		}
+	default:
+		return fmt.Errorf("invalid share_link_store: %s", c.ShareLinkStore)
+	}
+
+	if c.ShareLinkMaxTTLInSec <= 0 {
+		return errors.New("invalid share_link_max_ttl")
+	}
+
+	switch c.SessionStore {
+	case sessionStoreCookie, sessionStoreMemory:
+	case sessionStoreFile:
+		if c.SessionFile == "" {
+			return errors.New("session_file is required for file session_store")
+		}
+	default:
+		return fmt.Errorf("invalid session_store: %s", c.SessionStore)
+	}
+
 	return nil
 }
 
 func main() {
-	var cfg config
+	cfg := config{
+		GatewayTimeoutInSec:        30,
+		GatewayRetries:             2,
+		GatewayMaxIdleConns:        100,
+		BreakerThreshold:           5,
+		BreakerTimeoutInSec:        30,
+		ListCacheTTLInSec:          300,
+		SessionMaxLifetimeInSec:    24 * 60 * 60,
+		RememberMePeriodInSec:      30 * 24 * 60 * 60,
+		RememberMeMaxLifetimeInSec: 90 * 24 * 60 * 60,
+		TokenRefreshBeforeInSec:    5 * 60,
+		LoginAttemptsPerMinute:     10,
+		LoginLockoutThreshold:      5,
+		LoginLockoutInSec:          30,
+		LoginLockoutMaxInSec:       60 * 60,
+		PasswordMinLength:          8,
+		PasswordMinClasses:         2,
+		PublicStorages:             []string{"common"},
+		CookiePrefix:               wrapper.DefaultCookiePrefix,
+		CookieSecure:               true,
+		CookieSameSite:             "lax",
+		SessionStore:               sessionStoreCookie,
+		APITokenStore:              apiTokenStoreMemory,
+		ShareLinkStore:             shareLinkStoreMemory,
+		ShareLinkMaxTTLInSec:       7 * 24 * 60 * 60,
+		OIDC: oidcConfig{
+			Scopes:       []string{"openid", "email"},
+			GroupsClaim:  "groups",
+			TimeoutInSec: 10,
+		},
+	}
 	service.Run("web", &cfg, func(srv micro.Service, s service.Servicer) error {
-		cookieSession := wrapper.NewCookieSession(int64(cfg.SessionExpirePeriodInSec))
-		h := handler.New(cfg.GatewayHost, cookieSession, s.Logger())
+		gatewayTimeout := time.Duration(cfg.GatewayTimeoutInSec) * time.Second
+		gatewayOpts := []gateway.Option{
+			gateway.WithTimeout(gatewayTimeout),
+			gateway.WithRetries(cfg.GatewayRetries, 100*time.Millisecond),
+			gateway.WithTransport(gateway.NewTransport(cfg.GatewayMaxIdleConns, gatewayTimeout)),
+			gateway.WithBreaker(gateway.NewBreaker(cfg.BreakerThreshold, time.Duration(cfg.BreakerTimeoutInSec)*time.Second)),
+		}
+
+		// gateway_host overrides service discovery
+		if cfg.GatewayHost == "" {
+			sel := selector.NewSelector(selector.Registry(srv.Options().Registry))
+			gatewayOpts = append(gatewayOpts, gateway.WithResolver(gateway.NewRegistryResolver(cfg.GatewayService, sel)))
+		}
+
+		gw := gateway.New(cfg.GatewayHost, gatewayOpts...)
+
+		keys, err := cfg.cookieKeys()
+		if err != nil {
+			return err
+		}
+
+		if len(keys) == 0 {
+			key, err := generateCookieKey()
+			if err != nil {
+				return fmt.Errorf("cookie key: %w", err)
+			}
+			keys = append(keys, key)
+			s.Logger().Warn("cookie_keys is not set, using generated key: sessions, share links and public pages are lost on restart and are not shared between instances")
+		}
+
+		codec, err := wrapper.NewCookieCodec(keys...)
+		if err != nil {
+			return fmt.Errorf("cookie codec: %w", err)
+		}
+
+		sameSite, err := wrapper.ParseSameSite(cfg.CookieSameSite)
+		if err != nil {
+			return err
+		}
+
+		session, err := makeSession(&cfg, codec,
+			wrapper.WithCookiePrefix(cfg.CookiePrefix),
+			wrapper.WithCookieDomain(cfg.CookieDomain),
+			wrapper.WithCookieSecure(cfg.CookieSecure),
+			wrapper.WithCookieSameSite(sameSite),
+			wrapper.WithMaxLifetime(time.Duration(cfg.SessionMaxLifetimeInSec)*time.Second),
+			wrapper.WithRememberLifetime(wrapper.Lifetime{
+				Idle: time.Duration(cfg.RememberMePeriodInSec) * time.Second,
+				Max:  time.Duration(cfg.RememberMeMaxLifetimeInSec) * time.Second,
+			}),
+		)
+		if err != nil {
+			return err
+		}
+
+		trustedProxies, err := handler.ParseTrustedProxies(cfg.TrustedProxies)
+		if err != nil {
+			return err
+		}
+
+		handlerOpts := []handler.Option{
+			handler.WithAdminToken(cfg.AdminToken),
+			handler.WithTokenRefresh(time.Duration(cfg.TokenRefreshBeforeInSec) * time.Second),
+			handler.WithTrustedProxies(trustedProxies),
+			handler.WithPasswordPolicy(handler.PasswordPolicy{
+				MinLength:  cfg.PasswordMinLength,
+				MinClasses: cfg.PasswordMinClasses,
+			}),
+			handler.WithLoginLimits(handler.LoginLimits{
+				AttemptsPerMinute: cfg.LoginAttemptsPerMinute,
+				LockoutThreshold:  cfg.LoginLockoutThreshold,
+				LockoutBase:       time.Duration(cfg.LoginLockoutInSec) * time.Second,
+				LockoutMax:        time.Duration(cfg.LoginLockoutMaxInSec) * time.Second,
+			}),
+			handler.WithPublicStorages(cfg.PublicStorages),
+			handler.WithListCacheTTL(time.Duration(cfg.ListCacheTTLInSec) * time.Second),
+			handler.WithCSRFCookieSecure(cfg.CookieSecure),
+		}
+
+		if cfg.OIDC.enabled() {
+			handlerOpts = append(handlerOpts, handler.WithOIDC(makeOIDC(&cfg.OIDC, codec, cfg.CookieSecure)))
+		}
+
+		switch cfg.APITokenStore {
+		case apiTokenStoreMemory:
+			handlerOpts = append(handlerOpts, handler.WithAPITokens(wrapper.NewMemoryTokenStore()))
+		case apiTokenStoreFile:
+			store, err := wrapper.NewFileTokenStore(cfg.APITokenFile)
+			if err != nil {
+				return fmt.Errorf("file api token store: %w", err)
+			}
+			handlerOpts = append(handlerOpts, handler.WithAPITokens(store))
+		}
+
+		shareLinks := &handler.ShareLinks{
+			Keys:         keys,
+			MaxTTL:       time.Duration(cfg.ShareLinkMaxTTLInSec) * time.Second,
+			SecureCookie: cfg.CookieSecure,
+		}
+
+		switch cfg.ShareLinkStore {
+		case shareLinkStoreMemory:
+			shareLinks.Store = wrapper.NewMemoryShareStore()
+			handlerOpts = append(handlerOpts, handler.WithShareLinks(shareLinks))
+		case shareLinkStoreFile:
+			store, err := wrapper.NewFileShareStore(cfg.ShareLinkFile)
+			if err != nil {
+				return fmt.Errorf("file share link store: %w", err)
+			}
+			shareLinks.Store = store
+			handlerOpts = append(handlerOpts, handler.WithShareLinks(shareLinks))
+		}
+
+		h := handler.New(gw, session, s.Logger(), handlerOpts...)
 
 		router.MakeRoutes(s.Router(), true, h, s.Logger())
 		return nil
 	})
 }
+
+// makeSession creates session implementation selected by session_store
+func makeSession(cfg *config, codec *wrapper.CookieCodec, opts ...wrapper.CookieOption) (handler.Sessioner, error) {
+	period := int64(cfg.SessionExpirePeriodInSec)
+
+	var store wrapper.SessionStore
+	switch cfg.SessionStore {
+	case sessionStoreMemory:
+		store = wrapper.NewMemoryStore()
+	case sessionStoreFile:
+		fileStore, err := wrapper.NewFileStore(cfg.SessionFile)
+		if err != nil {
+			return nil, fmt.Errorf("file session store: %w", err)
+		}
+		store = fileStore
+	}
+
+	if store == nil {
+		cs, err := wrapper.NewCookieSession(period, codec, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("cookie session: %w", err)
+		}
+		return cs, nil
+	}
+
+	ss, err := wrapper.NewServerSession(period, store, codec, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("server session: %w", err)
+	}
+	return ss, nil
+}
+
+// makeOIDC creates single sign on provider and access list from config
+func makeOIDC(cfg *oidcConfig, sealer handler.CookieSealer, secureCookie bool) *handler.OIDC {
+	rules := make([]oidc.ACLRule, 0, len(cfg.ACL))
+	for _, r := range cfg.ACL {
+		rules = append(rules, oidc.ACLRule{
+			Storage: r.Storage,
+			Emails:  r.Emails,
+			Groups:  r.Groups,
+		})
+	}
+
+	return &handler.OIDC{
+		Provider: oidc.NewProvider(oidc.Config{
+			Issuer:       cfg.Issuer,
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       cfg.Scopes,
+		}, &http.Client{Timeout: time.Duration(cfg.TimeoutInSec) * time.Second}),
+		ACL:          oidc.NewACL(cfg.GroupsClaim, rules),
+		Sealer:       sealer,
+		SecureCookie: secureCookie,
+	}
+}
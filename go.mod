@@ -6,4 +6,5 @@ require (
 	github.com/Mikhalevich/filesharing v0.0.0-20220107114110-bc0816846177
 	github.com/asim/go-micro/v3 v3.6.0
 	github.com/gorilla/mux v1.8.0
+	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519
 )
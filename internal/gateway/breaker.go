@@ -0,0 +1,97 @@
+package gateway
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+// CircuitOpenError returned without calling gateway while it is considered to be down
+type CircuitOpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("gateway circuit is open, retry after %v", e.RetryAfter)
+}
+
+// Breaker is circuit breaker for gateway calls
+// it opens after threshold consecutive failures and lets single trial call through after open timeout
+type Breaker struct {
+	mu          sync.Mutex
+	threshold   int
+	openTimeout time.Duration
+	state       breakerState
+	failures    int
+	openedAt    time.Time
+	now         func() time.Time
+}
+
+// NewBreaker constructor for Breaker
+func NewBreaker(threshold int, openTimeout time.Duration) *Breaker {
+	return &Breaker{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		now:         time.Now,
+	}
+}
+
+// Allow checks whether call could be made, CircuitOpenError is returned otherwise
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case stateOpen:
+		elapsed := b.now().Sub(b.openedAt)
+		if elapsed < b.openTimeout {
+			return &CircuitOpenError{RetryAfter: b.openTimeout - elapsed}
+		}
+		b.state = stateHalfOpen
+		return nil
+	case stateHalfOpen:
+		// trial call is in progress
+		return &CircuitOpenError{RetryAfter: b.openTimeout}
+	}
+
+	return nil
+}
+
+// Success reports successful call
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = stateClosed
+	b.failures = 0
+}
+
+// Failure reports gateway failure
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == stateHalfOpen || b.failures >= b.threshold {
+		b.state = stateOpen
+		b.openedAt = b.now()
+	}
+}
+
+// Cancel reports call which was interrupted by the caller and says nothing about gateway health
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == stateHalfOpen {
+		b.state = stateOpen
+	}
+}
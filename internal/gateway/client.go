@@ -0,0 +1,434 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+const (
+	defaultTimeout      = 30 * time.Second
+	defaultRetries      = 2
+	defaultRetryBackoff = 100 * time.Millisecond
+	formContentType     = "application/x-www-form-urlencoded"
+)
+
+// File represents one file from storage
+type File struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"`
+}
+
+// Params represents parameters of the single gateway call
+type Params struct {
+	Token  string
+	Values url.Values
+	Header http.Header
+	// OnToken is called when gateway issues a new token for the storage
+	OnToken func(token string)
+}
+
+// Client is typed http client for the filesharing gateway
+type Client struct {
+	resolver     Resolver
+	client       *http.Client
+	timeout      time.Duration
+	retries      int
+	retryBackoff time.Duration
+	breaker      *Breaker
+}
+
+// Option configures optional Client parameters
+type Option func(c *Client)
+
+// WithTimeout sets deadline for the whole non streaming call including reading response body
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithRetries sets number of retries for safe(GET) calls and base backoff between them
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.retryBackoff = backoff
+	}
+}
+
+// WithResolver replaces static gateway host with dynamic resolver
+func WithResolver(r Resolver) Option {
+	return func(c *Client) {
+		c.resolver = r
+	}
+}
+
+// WithBreaker protects gateway calls with circuit breaker
+func WithBreaker(b *Breaker) Option {
+	return func(c *Client) {
+		c.breaker = b
+	}
+}
+
+// WithTransport replaces default transport
+func WithTransport(t http.RoundTripper) Option {
+	return func(c *Client) {
+		c.client.Transport = t
+	}
+}
+
+// NewTransport makes pooled transport for gateway connections
+func NewTransport(maxIdleConns int, responseHeaderTimeout time.Duration) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          maxIdleConns,
+		MaxIdleConnsPerHost:   maxIdleConns,
+		IdleConnTimeout:       90 * time.Second,
+		ResponseHeaderTimeout: responseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// New constructor for Client
+func New(host string, opts ...Option) *Client {
+	c := &Client{
+		resolver: StaticResolver(host),
+		client: &http.Client{
+			Transport: NewTransport(100, defaultTimeout),
+		},
+		timeout:      defaultTimeout,
+		retries:      defaultRetries,
+		retryBackoff: defaultRetryBackoff,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// List returns files from storage
+func (c *Client) List(ctx context.Context, p Params) ([]File, *httperror.Error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	rsp, httpErr := c.do(ctx, http.MethodGet, "list", p, nil, "")
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	defer rsp.Body.Close()
+
+	var files []File
+	if err := json.NewDecoder(rsp.Body).Decode(&files); err != nil {
+		return nil, httperror.NewInternalError("files json decode error").WithError(err)
+	}
+
+	return files, nil
+}
+
+// File returns response with file content, caller must close response body
+// the call is not limited by timeout because of possible large files
+func (c *Client) File(ctx context.Context, p Params) (*http.Response, *httperror.Error) {
+	return c.do(ctx, http.MethodGet, "file", p, nil, "")
+}
+
+// IndexHTML returns response with index.html content, caller must close response body
+func (c *Client) IndexHTML(ctx context.Context, p Params) (*http.Response, *httperror.Error) {
+	ctx, cancel := c.withTimeout(ctx)
+
+	rsp, httpErr := c.do(ctx, http.MethodGet, "index.html", p, nil, "")
+	if httpErr != nil {
+		cancel()
+		return nil, httpErr
+	}
+
+	rsp.Body = &cancelReadCloser{ReadCloser: rsp.Body, cancel: cancel}
+	return rsp, nil
+}
+
+// Upload sends multipart body to the storage
+// the call is limited by request context only because of possible large files
+func (c *Client) Upload(ctx context.Context, p Params, body io.Reader, contentType string) *httperror.Error {
+	rsp, httpErr := c.do(ctx, http.MethodPost, "upload", p, body, contentType)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	return drain(rsp)
+}
+
+// Remove removes file from storage
+func (c *Client) Remove(ctx context.Context, p Params) *httperror.Error {
+	return c.post(ctx, "remove", p)
+}
+
+// ShareText creates file from title and body values
+func (c *Client) ShareText(ctx context.Context, p Params) *httperror.Error {
+	return c.post(ctx, "shareText", p)
+}
+
+// Login returns token for storage name and password values
+func (c *Client) Login(ctx context.Context, p Params) (string, *httperror.Error) {
+	return c.token(ctx, "login", p)
+}
+
+// Register creates a new storage and returns token for it
+func (c *Client) Register(ctx context.Context, p Params) (string, *httperror.Error) {
+	return c.token(ctx, "register", p)
+}
+
+// ChangePassword changes storage password, values should contain current and new password
+func (c *Client) ChangePassword(ctx context.Context, p Params) *httperror.Error {
+	return c.post(ctx, "changePassword", p)
+}
+
+// DeleteStorage removes storage with all files, values should contain storage password
+func (c *Client) DeleteStorage(ctx context.Context, p Params) *httperror.Error {
+	return c.post(ctx, "deleteStorage", p)
+}
+
+// Refresh exchanges still valid token to the new one with extended expiration
+func (c *Client) Refresh(ctx context.Context, p Params) (string, *httperror.Error) {
+	return c.token(ctx, "refresh", p)
+}
+
+// ExchangeToken returns token for the storage identity verified by external identity provider
+// values should contain storage, subject and id_token
+func (c *Client) ExchangeToken(ctx context.Context, p Params) (string, *httperror.Error) {
+	return c.token(ctx, "exchangeToken", p)
+}
+
+// IssueToken returns long lived token for personal api token of the storage
+// values should contain storage, scope and optional expires_at unix time
+func (c *Client) IssueToken(ctx context.Context, p Params) (string, *httperror.Error) {
+	return c.token(ctx, "issueToken", p)
+}
+
+func (c *Client) post(ctx context.Context, endpoint string, p Params) *httperror.Error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	rsp, httpErr := c.do(ctx, http.MethodPost, endpoint, p, strings.NewReader(p.Values.Encode()), formContentType)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	return drain(rsp)
+}
+
+func (c *Client) token(ctx context.Context, endpoint string, p Params) (string, *httperror.Error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	rsp, httpErr := c.do(ctx, http.MethodPost, endpoint, p, strings.NewReader(p.Values.Encode()), formContentType)
+	if httpErr != nil {
+		return "", httpErr
+	}
+	defer rsp.Body.Close()
+
+	token, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return "", httperror.NewInternalError("invalid session token").WithError(err)
+	}
+
+	return string(token), nil
+}
+
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+func makeURL(host string, endpoint string) string {
+	return fmt.Sprintf("%s/%s/", host, endpoint)
+}
+
+func (c *Client) newRequest(ctx context.Context, host string, method string, endpoint string, p Params, body io.Reader, contentType string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, makeURL(host, endpoint), body)
+	if err != nil {
+		return nil, err
+	}
+
+	// form values are sent in the body, other requests carry them in the query
+	if contentType != formContentType {
+		req.URL.RawQuery = p.Values.Encode()
+	}
+
+	for name, vals := range p.Header {
+		for _, v := range vals {
+			req.Header.Add(name, v)
+		}
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	if p.Token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.Token))
+	}
+
+	return req, nil
+}
+
+// do sends request to the gateway, safe requests are retried on gateway unavailability
+func (c *Client) do(ctx context.Context, method string, endpoint string, p Params, body io.Reader, contentType string) (*http.Response, *httperror.Error) {
+	if c.breaker == nil {
+		return c.doRetry(ctx, method, endpoint, p, body, contentType)
+	}
+
+	if err := c.breaker.Allow(); err != nil {
+		return nil, httperror.NewInternalError("gateway unavailable").WithError(err)
+	}
+
+	rsp, httpErr := c.doRetry(ctx, method, endpoint, p, body, contentType)
+
+	var gwErr *Error
+	switch {
+	case httpErr == nil:
+		c.breaker.Success()
+	case errors.Is(ctx.Err(), context.Canceled):
+		c.breaker.Cancel()
+	case errors.As(httpErr, &gwErr) && (gwErr.Status == 0 || gwErr.Status >= http.StatusInternalServerError):
+		c.breaker.Failure()
+	default:
+		// gateway responded with regular or client error
+		c.breaker.Success()
+	}
+
+	return rsp, httpErr
+}
+
+func (c *Client) doRetry(ctx context.Context, method string, endpoint string, p Params, body io.Reader, contentType string) (*http.Response, *httperror.Error) {
+	attempts := 1
+	if method == http.MethodGet {
+		attempts += c.retries
+	}
+
+	var lastErr *Error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := c.sleep(ctx, attempt); err != nil {
+				break
+			}
+		}
+
+		host, done, err := c.resolver.Resolve()
+		if err != nil {
+			lastErr = &Error{Err: err}
+			continue
+		}
+
+		req, err := c.newRequest(ctx, host, method, endpoint, p, body, contentType)
+		if err != nil {
+			done(err)
+			return nil, httperror.NewInternalError("make request").WithError(err)
+		}
+
+		rsp, err := c.client.Do(req)
+		if err != nil {
+			lastErr = &Error{Err: err}
+			done(lastErr)
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+
+		if isRetryableStatus(rsp.StatusCode) {
+			lastErr = newStatusError(rsp)
+			done(lastErr)
+			rsp.Body.Close()
+			continue
+		}
+
+		done(nil)
+
+		return c.processResponse(rsp, p)
+	}
+
+	return nil, httperror.NewInternalError("do request").WithError(lastErr)
+}
+
+func (c *Client) processResponse(rsp *http.Response, p Params) (*http.Response, *httperror.Error) {
+	if rsp.StatusCode != http.StatusOK && rsp.StatusCode != http.StatusPartialContent {
+		defer rsp.Body.Close()
+
+		if rsp.StatusCode == http.StatusBadRequest {
+			var httpErr httperror.Error
+			if err := json.NewDecoder(rsp.Body).Decode(&httpErr); err != nil {
+				return nil, httperror.NewInternalError("json decode").WithError(&Error{Status: rsp.StatusCode, Err: err})
+			}
+
+			return nil, &httpErr
+		}
+
+		return nil, httperror.NewInternalError("invalid status code").WithError(newStatusError(rsp))
+	}
+
+	if token := rsp.Header.Get("X-Token"); token != "" && p.OnToken != nil {
+		p.OnToken(token)
+	}
+
+	return rsp, nil
+}
+
+// sleep waits jittered exponential backoff before the next attempt
+func (c *Client) sleep(ctx context.Context, attempt int) error {
+	backoff := c.retryBackoff << uint(attempt-1)
+	jitter := time.Duration(rand.Int63n(int64(backoff) + 1))
+
+	timer := time.NewTimer(backoff/2 + jitter/2)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusBadGateway ||
+		status == http.StatusServiceUnavailable ||
+		status == http.StatusGatewayTimeout
+}
+
+func drain(rsp *http.Response) *httperror.Error {
+	defer rsp.Body.Close()
+	if _, err := io.Copy(ioutil.Discard, rsp.Body); err != nil {
+		return httperror.NewInternalError("read response").WithError(&Error{Status: rsp.StatusCode, Err: err})
+	}
+	return nil
+}
+
+// cancelReadCloser releases call context after the body is closed
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelReadCloser) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
@@ -0,0 +1,61 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientBreakerCountsGatewayFailuresOnly(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantOpen bool
+	}{
+		{name: "ok", status: http.StatusOK, body: "[]"},
+		{name: "regular error", status: http.StatusBadRequest, body: `{"code":6,"description":"password does not match"}`},
+		{name: "unauthorized", status: http.StatusUnauthorized},
+		{name: "not found", status: http.StatusNotFound},
+		{name: "conflict", status: http.StatusConflict},
+		{name: "internal error", status: http.StatusInternalServerError, wantOpen: true},
+		{name: "bad gateway", status: http.StatusBadGateway, wantOpen: true},
+		{name: "unavailable", status: http.StatusServiceUnavailable, wantOpen: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			breaker := NewBreaker(1, time.Minute)
+			c := New(srv.URL, WithBreaker(breaker), WithRetries(0, time.Millisecond))
+			c.List(context.Background(), Params{})
+
+			if open := breaker.Allow() != nil; open != tt.wantOpen {
+				t.Fatalf("breaker open = %t, want %t", open, tt.wantOpen)
+			}
+		})
+	}
+}
+
+func TestClientBreakerCountsTransportErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	host := srv.URL
+	srv.Close()
+
+	breaker := NewBreaker(1, time.Minute)
+	c := New(host, WithBreaker(breaker), WithRetries(0, time.Millisecond))
+	if _, httpErr := c.List(context.Background(), Params{}); httpErr == nil {
+		t.Fatal("expected transport error")
+	}
+
+	if breaker.Allow() == nil {
+		t.Fatal("breaker should be open after transport error")
+	}
+}
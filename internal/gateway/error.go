@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+)
+
+const (
+	maxErrorBodyLog = 1024
+)
+
+// Error describes failed communication with gateway
+// keeps original gateway status and body for logging
+type Error struct {
+	Status int
+	Body   string
+	Err    error
+}
+
+func newStatusError(rsp *http.Response) *Error {
+	body, err := ioutil.ReadAll(io.LimitReader(rsp.Body, maxErrorBodyLog))
+	return &Error{
+		Status: rsp.StatusCode,
+		Body:   string(body),
+		Err:    err,
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Status == 0 {
+		return fmt.Sprintf("gateway unavailable: %v", e.Err)
+	}
+
+	if e.Err != nil {
+		return fmt.Sprintf("gateway status = %d, body = %q, err = %v", e.Status, e.Body, e.Err)
+	}
+
+	return fmt.Sprintf("gateway status = %d, body = %q", e.Status, e.Body)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatus returns 504 for gateway timeouts and 502 for other gateway failures
+func (e *Error) HTTPStatus() int {
+	if e.Status == http.StatusGatewayTimeout || errors.Is(e.Err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(e.Err, &netErr) && netErr.Timeout() {
+		return http.StatusGatewayTimeout
+	}
+
+	return http.StatusBadGateway
+}
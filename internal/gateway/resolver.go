@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/asim/go-micro/v3/selector"
+)
+
+const (
+	// HTTPAddressMetadata is registry node metadata key with http address of the gateway instance
+	// node address is used if it is not set
+	HTTPAddressMetadata = "http_address"
+)
+
+// Resolver returns gateway base url for the next call
+// done should be called with call result so resolver could track instance health
+type Resolver interface {
+	Resolve() (host string, done func(err error), err error)
+}
+
+// StaticResolver always returns the same host
+type StaticResolver string
+
+func (s StaticResolver) Resolve() (string, func(err error), error) {
+	return string(s), func(error) {}, nil
+}
+
+// RegistryResolver discovers gateway instances by service name through go-micro selector
+type RegistryResolver struct {
+	service  string
+	selector selector.Selector
+}
+
+// NewRegistryResolver constructor for RegistryResolver
+func NewRegistryResolver(service string, s selector.Selector) *RegistryResolver {
+	return &RegistryResolver{
+		service:  service,
+		selector: s,
+	}
+}
+
+func (rr *RegistryResolver) Resolve() (string, func(err error), error) {
+	next, err := rr.selector.Select(rr.service)
+	if err != nil {
+		return "", nil, fmt.Errorf("select %s: %w", rr.service, err)
+	}
+
+	node, err := next()
+	if err != nil {
+		return "", nil, fmt.Errorf("next node %s: %w", rr.service, err)
+	}
+
+	addr := node.Address
+	if httpAddr := node.Metadata[HTTPAddressMetadata]; httpAddr != "" {
+		addr = httpAddr
+	}
+
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+
+	return addr, func(err error) {
+		rr.selector.Mark(rr.service, node, err)
+	}, nil
+}
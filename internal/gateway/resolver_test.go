@@ -0,0 +1,211 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asim/go-micro/v3/registry"
+	"github.com/asim/go-micro/v3/selector"
+)
+
+// markSelector records marks reported by resolver
+type markSelector struct {
+	selector.Selector
+	service string
+	node    *registry.Node
+	err     error
+	marks   int
+}
+
+func (s *markSelector) Mark(service string, node *registry.Node, err error) {
+	s.service = service
+	s.node = node
+	s.err = err
+	s.marks++
+}
+
+func newTestSelector(t *testing.T, nodes ...*registry.Node) selector.Selector {
+	t.Helper()
+
+	reg := registry.NewMemoryRegistry()
+	if len(nodes) > 0 {
+		err := reg.Register(&registry.Service{
+			Name:    "gateway",
+			Version: "latest",
+			Nodes:   nodes,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return selector.NewSelector(selector.Registry(reg))
+}
+
+func TestRegistryResolverSelection(t *testing.T) {
+	tests := []struct {
+		name string
+		node *registry.Node
+		want string
+	}{
+		{
+			name: "http address from metadata",
+			node: &registry.Node{
+				Id:       "gw-1",
+				Address:  "10.0.0.1:9000",
+				Metadata: map[string]string{HTTPAddressMetadata: "10.0.0.1:8080"},
+			},
+			want: "http://10.0.0.1:8080",
+		},
+		{
+			name: "metadata with scheme",
+			node: &registry.Node{
+				Id:       "gw-1",
+				Address:  "10.0.0.1:9000",
+				Metadata: map[string]string{HTTPAddressMetadata: "https://gw.example:8443"},
+			},
+			want: "https://gw.example:8443",
+		},
+		{
+			name: "missing http address falls back to node address",
+			node: &registry.Node{
+				Id:       "gw-1",
+				Address:  "10.0.0.1:9000",
+				Metadata: map[string]string{"transport": "grpc"},
+			},
+			want: "http://10.0.0.1:9000",
+		},
+		{
+			name: "empty http address falls back to node address",
+			node: &registry.Node{
+				Id:       "gw-1",
+				Address:  "10.0.0.1:9000",
+				Metadata: map[string]string{HTTPAddressMetadata: ""},
+			},
+			want: "http://10.0.0.1:9000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := NewRegistryResolver("gateway", newTestSelector(t, tt.node))
+
+			host, done, err := rr.Resolve()
+			if err != nil {
+				t.Fatalf("resolve: %v", err)
+			}
+
+			if host != tt.want {
+				t.Fatalf("host = %q, want %q", host, tt.want)
+			}
+
+			done(nil)
+		})
+	}
+}
+
+func TestRegistryResolverSelectsRegisteredNodes(t *testing.T) {
+	rr := NewRegistryResolver("gateway", newTestSelector(t,
+		&registry.Node{Id: "gw-1", Address: "10.0.0.1:9000"},
+		&registry.Node{Id: "gw-2", Address: "10.0.0.2:9000"},
+	))
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		host, _, err := rr.Resolve()
+		if err != nil {
+			t.Fatalf("resolve: %v", err)
+		}
+		seen[host] = true
+	}
+
+	for _, want := range []string{"http://10.0.0.1:9000", "http://10.0.0.2:9000"} {
+		if !seen[want] {
+			t.Errorf("node %s was never selected, seen %v", want, seen)
+		}
+	}
+
+	if len(seen) != 2 {
+		t.Errorf("unexpected hosts %v", seen)
+	}
+}
+
+func TestRegistryResolverMarksNode(t *testing.T) {
+	node := &registry.Node{Id: "gw-1", Address: "10.0.0.1:9000"}
+	s := &markSelector{Selector: newTestSelector(t, node)}
+	rr := NewRegistryResolver("gateway", s)
+
+	_, done, err := rr.Resolve()
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	callErr := errors.New("connection refused")
+	done(callErr)
+
+	if s.marks != 1 {
+		t.Fatalf("marks = %d, want 1", s.marks)
+	}
+
+	if s.service != "gateway" || s.node == nil || s.node.Id != node.Id {
+		t.Errorf("marked service %q node %+v", s.service, s.node)
+	}
+
+	if !errors.Is(s.err, callErr) {
+		t.Errorf("marked error = %v, want %v", s.err, callErr)
+	}
+
+	done(nil)
+	if s.marks != 2 || s.err != nil {
+		t.Errorf("success should be marked with nil error, marks = %d err = %v", s.marks, s.err)
+	}
+}
+
+func TestRegistryResolverServiceNotFound(t *testing.T) {
+	rr := NewRegistryResolver("gateway", newTestSelector(t))
+
+	if _, _, err := rr.Resolve(); err == nil {
+		t.Fatal("expected error for missing service")
+	}
+}
+
+func TestStaticResolver(t *testing.T) {
+	r := StaticResolver("http://localhost:8080")
+
+	for i := 0; i < 3; i++ {
+		host, done, err := r.Resolve()
+		if err != nil {
+			t.Fatalf("resolve: %v", err)
+		}
+
+		if host != "http://localhost:8080" {
+			t.Fatalf("host = %q, want %q", host, "http://localhost:8080")
+		}
+
+		// done is a no-op but must be callable
+		done(errors.New("failure"))
+		done(nil)
+	}
+}
+
+func TestClientMarksFailedNode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	srv.Close()
+
+	s := &markSelector{Selector: newTestSelector(t, &registry.Node{Id: "gw-1", Address: addr})}
+	c := New("", WithResolver(NewRegistryResolver("gateway", s)), WithRetries(0, time.Millisecond))
+
+	if _, httpErr := c.List(context.Background(), Params{}); httpErr == nil {
+		t.Fatal("expected error from stopped gateway")
+	}
+
+	if s.marks != 1 || s.err == nil {
+		t.Fatalf("failed call should be marked with error, marks = %d err = %v", s.marks, s.err)
+	}
+}
@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+type apiTokenResponse struct {
+	Token string `json:"token"`
+}
+
+type apiFileResponse struct {
+	Name string `json:"name"`
+}
+
+type apiCredentials struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+type apiText struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// APIError writes error envelope with http status code corresponding to the error
+// unlike Error it never redirects
+func (h *Handler) APIError(err *httperror.Error, w http.ResponseWriter, handler string) {
+	status := errorStatus(err)
+	h.logger.WithError(err).
+		WithField("handler", handler).
+		WithField("status", status).
+		Error("api handler error")
+
+	setRetryAfter(w, err)
+	writeJSON(w, status, err)
+}
+
+func decodeJSON(r *http.Request, v interface{}) *httperror.Error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return httperror.NewInvalidParams("invalid json body").WithError(err)
+	}
+	return nil
+}
+
+// APIListHandler returns files from storage
+func (h *Handler) APIListHandler(w http.ResponseWriter, r *http.Request) {
+	sp, err := h.requestParameters(r)
+	if err != nil {
+		h.APIError(httperror.NewInvalidParams("request parametes").WithError(err), w, "APIListHandler")
+		return
+	}
+
+	files, httpErr := h.listFiles(r, w, sp)
+	if httpErr != nil {
+		h.APIError(httpErr, w, "APIListHandler")
+		return
+	}
+
+	if files == nil {
+		files = []File{}
+	}
+
+	writeJSON(w, http.StatusOK, files)
+}
+
+// APIUploadHandler stores request body as file with name from url
+func (h *Handler) APIUploadHandler(w http.ResponseWriter, r *http.Request) {
+	sp, err := h.requestParameters(r)
+	if err != nil {
+		h.APIError(httperror.NewInvalidParams("request parametes").WithError(err), w, "APIUploadHandler")
+		return
+	}
+
+	body, contentType, errCh := fileBody(sp.FileName, r.Body)
+	if httpErr := h.uploadStream(r, w, sp, body, contentType, errCh); httpErr != nil {
+		h.APIError(httpErr, w, "APIUploadHandler")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, apiFileResponse{Name: sp.FileName})
+}
+
+// APIRemoveHandler removes file with name from url
+func (h *Handler) APIRemoveHandler(w http.ResponseWriter, r *http.Request) {
+	sp, err := h.requestParameters(r)
+	if err != nil {
+		h.APIError(httperror.NewInvalidParams("request parametes").WithError(err), w, "APIRemoveHandler")
+		return
+	}
+
+	if httpErr := h.gw.Remove(r.Context(), h.gatewayParams(r, w, sp.StorageName, sp.Values())); httpErr != nil {
+		h.APIError(h.gatewayError(r, w, sp.StorageName, httpErr), w, "APIRemoveHandler")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIShareTextHandler creates file from json title and body
+func (h *Handler) APIShareTextHandler(w http.ResponseWriter, r *http.Request) {
+	var text apiText
+	if httpErr := decodeJSON(r, &text); httpErr != nil {
+		h.APIError(httpErr, w, "APIShareTextHandler")
+		return
+	}
+
+	if text.Title == "" || text.Body == "" {
+		h.APIError(httperror.NewInvalidParams("title or body was not set"), w, "APIShareTextHandler")
+		return
+	}
+
+	sp, err := h.requestParameters(r)
+	if err != nil {
+		h.APIError(httperror.NewInvalidParams("request parametes").WithError(err), w, "APIShareTextHandler")
+		return
+	}
+
+	values := sp.Values()
+	values.Add("title", text.Title)
+	values.Add("body", text.Body)
+
+	if httpErr := h.gw.ShareText(r.Context(), h.gatewayParams(r, w, sp.StorageName, values)); httpErr != nil {
+		h.APIError(h.gatewayError(r, w, sp.StorageName, httpErr), w, "APIShareTextHandler")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, apiFileResponse{Name: text.Title})
+}
+
+// APILoginHandler exchanges storage password to the bearer token
+func (h *Handler) APILoginHandler(w http.ResponseWriter, r *http.Request) {
+	var creds apiCredentials
+	if httpErr := decodeJSON(r, &creds); httpErr != nil {
+		h.APIError(httpErr, w, "APILoginHandler")
+		return
+	}
+
+	sp, err := h.requestParameters(r)
+	if err != nil {
+		h.APIError(httperror.NewInvalidParams("request parametes").WithError(err), w, "APILoginHandler")
+		return
+	}
+
+	if creds.Password == "" {
+		h.APIError(httperror.NewInvalidParams("password was not set"), w, "APILoginHandler")
+		return
+	}
+
+	ip := h.clientIP(r)
+	if httpErr := h.loginLimiter.Allow(ip, sp.StorageName); httpErr != nil {
+		h.APIError(httpErr, w, "APILoginHandler")
+		return
+	}
+
+	values := sp.Values()
+	values.Add("password", creds.Password)
+
+	token, httpErr := h.gw.Login(r.Context(), h.gatewayParams(r, w, sp.StorageName, values))
+	if httpErr != nil {
+		if httpErr.Code == httperror.CodeNotMatch || httpErr.Code == httperror.CodeNotExist {
+			h.loginLimiter.Failure(ip, sp.StorageName)
+		}
+		h.APIError(httpErr, w, "APILoginHandler")
+		return
+	}
+
+	h.loginLimiter.Success(ip, sp.StorageName)
+
+	writeJSON(w, http.StatusOK, apiTokenResponse{Token: token})
+}
+
+// APIRegisterHandler creates a new storage and returns bearer token for it
+func (h *Handler) APIRegisterHandler(w http.ResponseWriter, r *http.Request) {
+	var creds apiCredentials
+	if httpErr := decodeJSON(r, &creds); httpErr != nil {
+		h.APIError(httpErr, w, "APIRegisterHandler")
+		return
+	}
+
+	if creds.Name == "" {
+		h.APIError(httperror.NewInvalidParams("storage name was not set"), w, "APIRegisterHandler")
+		return
+	}
+
+	if err := validateStorageName(creds.Name); err != nil {
+		h.APIError(httperror.NewInvalidParams("storage name").WithError(err), w, "APIRegisterHandler")
+		return
+	}
+
+	if err := h.passwordPolicy.Validate(creds.Name, creds.Password); err != nil {
+		h.APIError(httperror.NewInvalidParams("password").WithError(err), w, "APIRegisterHandler")
+		return
+	}
+
+	token, httpErr := h.gw.Register(r.Context(), h.gatewayParams(r, w, creds.Name, registerValues(creds.Name, creds.Password)))
+	if httpErr != nil {
+		h.APIError(httpErr, w, "APIRegisterHandler")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, apiTokenResponse{Token: token})
+}
@@ -0,0 +1,361 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/template"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+const (
+	// APITokenPrefix distinguishes personal api tokens from gateway session tokens
+	APITokenPrefix = "fsp_"
+
+	apiTokenIDLength     = 8
+	apiTokenSecretLength = 32
+	maxAPITokenLabel     = 64
+	maxAPITokens         = 50
+)
+
+// token scopes
+const (
+	ScopeRead   = "read"
+	ScopeUpload = "upload"
+	ScopeDelete = "delete"
+)
+
+var (
+	// ErrInvalidAPIToken indicates unknown, expired or malformed personal api token
+	ErrInvalidAPIToken = errors.New("invalid api token")
+
+	apiTokenScopes = []string{ScopeRead, ScopeUpload, ScopeDelete}
+)
+
+// ScopeError indicates that personal api token has no scope required by the route
+type ScopeError struct {
+	Scope string
+}
+
+func (e *ScopeError) Error() string {
+	return fmt.Sprintf("token has no %s scope", e.Scope)
+}
+
+// APIToken is personal access token of the storage
+// only secret hash is kept, gateway token is never shown to the token owner
+type APIToken struct {
+	ID           string    `json:"id"`
+	Storage      string    `json:"storage"`
+	Label        string    `json:"label"`
+	Scopes       []string  `json:"scopes"`
+	SecretHash   string    `json:"secret_hash"`
+	GatewayToken string    `json:"gateway_token"`
+	CreatedAt    time.Time `json:"created_at"`
+	// ExpiresAt zero value means token never expires
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Expired reports whether token is expired at the moment
+func (t APIToken) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+// HasScope reports whether token grants the scope
+func (t APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APITokenStore keeps personal api tokens by id
+type APITokenStore interface {
+	Get(id string) (APIToken, bool, error)
+	List(storage string) ([]APIToken, error)
+	Save(t APIToken) error
+	// UpdateGatewayToken replaces gateway token of the existing token only, false means that token is revoked
+	UpdateGatewayToken(id string, gatewayToken string) (bool, error)
+	Delete(storage string, id string) error
+	// DeleteStorage removes all tokens of the storage
+	DeleteStorage(storage string) error
+}
+
+// WithAPITokens enables personal api tokens
+func WithAPITokens(store APITokenStore) Option {
+	return func(h *Handler) {
+		h.apiTokens = store
+	}
+}
+
+type apiTokenContextKey struct{}
+
+// TokenScopeMiddleware authorizes personal api token from bearer header
+// the token should grant scope, it is replaced with the gateway token for the rest of the request
+// routes without scope do not check bearer tokens here, they are forwarded to the gateway which rejects invalid ones
+// including personal api tokens, routes acting on the local state only are session only and reject bearer tokens
+func (h *Handler) TokenScopeMiddleware(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer := bearerToken(r)
+		if h.apiTokens == nil || !strings.HasPrefix(bearer, APITokenPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sp, err := h.requestParameters(r)
+		if err != nil {
+			h.APIError(httperror.NewInvalidParams("request parametes").WithError(err), w, "TokenScopeMiddleware")
+			return
+		}
+
+		token, httpErr := h.apiToken(bearer, sp.StorageName)
+		if httpErr != nil {
+			h.APIError(httpErr, w, "TokenScopeMiddleware")
+			return
+		}
+
+		if !token.HasScope(scope) {
+			h.APIError(httperror.NewUnauthorized("insufficient token scope").WithError(&ScopeError{Scope: scope}), w, "TokenScopeMiddleware")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiTokenContextKey{}, token)))
+	})
+}
+
+// apiToken finds token by value and checks that it belongs to the storage
+func (h *Handler) apiToken(value string, storageName string) (APIToken, *httperror.Error) {
+	id, secret, ok := parseAPIToken(value)
+	if !ok {
+		return APIToken{}, httperror.NewUnauthorized("invalid api token").WithError(ErrInvalidAPIToken)
+	}
+
+	token, ok, err := h.apiTokens.Get(id)
+	if err != nil {
+		return APIToken{}, httperror.NewInternalError("api token store").WithError(err)
+	}
+
+	if !ok || token.Storage != storageName || token.Expired(time.Now()) ||
+		subtle.ConstantTimeCompare([]byte(hashAPITokenSecret(secret)), []byte(token.SecretHash)) != 1 {
+		return APIToken{}, httperror.NewUnauthorized("invalid api token").WithError(ErrInvalidAPIToken)
+	}
+
+	return token, nil
+}
+
+// requestAPIToken returns personal api token authorized by TokenScopeMiddleware
+func requestAPIToken(r *http.Request) (APIToken, bool) {
+	token, ok := r.Context().Value(apiTokenContextKey{}).(APIToken)
+	return token, ok
+}
+
+// updateGatewayToken keeps token reissued by gateway for the next requests
+// token revoked while the request was in flight stays revoked
+func (h *Handler) updateGatewayToken(token APIToken, gatewayToken string) {
+	if _, err := h.apiTokens.UpdateGatewayToken(token.ID, gatewayToken); err != nil {
+		h.logger.WithError(err).
+			WithField("storage", token.Storage).
+			Error("unable to update api token")
+	}
+}
+
+// newAPITokenValue generates token id and secret, the value is shown to the user only once
+func newAPITokenValue() (id string, secret string, value string, err error) {
+	b := make([]byte, apiTokenIDLength+apiTokenSecretLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", fmt.Errorf("random: %w", err)
+	}
+
+	id = hex.EncodeToString(b[:apiTokenIDLength])
+	secret = hex.EncodeToString(b[apiTokenIDLength:])
+	return id, secret, APITokenPrefix + id + "_" + secret, nil
+}
+
+func parseAPIToken(value string) (string, string, bool) {
+	parts := strings.Split(strings.TrimPrefix(value, APITokenPrefix), "_")
+	if len(parts) != 2 || len(parts[0]) != 2*apiTokenIDLength || len(parts[1]) != 2*apiTokenSecretLength {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+func hashAPITokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// APITokensHandler lists personal api tokens of the storage and creates new ones
+func (h *Handler) APITokensHandler(w http.ResponseWriter, r *http.Request) {
+	if h.apiTokens == nil {
+		h.Error(httperror.NewNotExistError("api tokens are disabled"), w, "APITokensHandler")
+		return
+	}
+
+	sp, err := h.requestParameters(r)
+	if err != nil {
+		h.Error(httperror.NewInvalidParams("request parametes").WithError(err), w, "APITokensHandler")
+		return
+	}
+
+	tokensInfo := template.NewTemplateAPITokens(Title, sp.StorageName)
+	tokensInfo.CSRFToken = csrfToken(r)
+
+	if r.Method == http.MethodPost {
+		value, httpErr := h.createAPIToken(r, w, sp, tokensInfo)
+		if httpErr != nil {
+			h.Error(httpErr, w, "APITokensHandler")
+			return
+		}
+		tokensInfo.NewToken = value
+	}
+
+	tokens, err := h.apiTokens.List(sp.StorageName)
+	if err != nil {
+		h.Error(httperror.NewInternalError("list api tokens").WithError(err), w, "APITokensHandler")
+		return
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+
+	now := time.Now()
+	for _, t := range tokens {
+		info := template.APITokenInfo{
+			ID:        t.ID,
+			Label:     t.Label,
+			Scopes:    strings.Join(t.Scopes, ", "),
+			CreatedAt: t.CreatedAt.Unix(),
+			Expired:   t.Expired(now),
+		}
+		if !t.ExpiresAt.IsZero() {
+			info.ExpiresAt = t.ExpiresAt.Unix()
+		}
+		tokensInfo.Tokens = append(tokensInfo.Tokens, info)
+	}
+
+	if err := tokensInfo.Execute(w); err != nil {
+		h.logger.Error(err)
+	}
+}
+
+// createAPIToken validates the form and issues the new token
+// form errors are added to the template, returned error is fatal for the page
+func (h *Handler) createAPIToken(r *http.Request, w http.ResponseWriter, sp storageParameters, tokensInfo *template.TemplateAPITokens) (string, *httperror.Error) {
+	label := strings.TrimSpace(r.FormValue("label"))
+	if label == "" || len(label) > maxAPITokenLabel {
+		tokensInfo.AddError("label", "label should be from 1 to %d characters long", maxAPITokenLabel)
+	}
+
+	var scopes []string
+	for _, s := range apiTokenScopes {
+		if r.FormValue("scope_"+s) == "true" {
+			scopes = append(scopes, s)
+		}
+	}
+
+	if len(scopes) == 0 {
+		tokensInfo.AddError("scopes", "please select at least one scope")
+	}
+
+	var expiresAt time.Time
+	if days := r.FormValue("expires_in_days"); days != "" && days != "0" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			tokensInfo.AddError("expires", "invalid expiration")
+		} else {
+			expiresAt = time.Now().Add(time.Duration(n) * 24 * time.Hour)
+		}
+	}
+
+	if len(tokensInfo.Errors) > 0 {
+		return "", nil
+	}
+
+	existing, err := h.apiTokens.List(sp.StorageName)
+	if err != nil {
+		return "", httperror.NewInternalError("list api tokens").WithError(err)
+	}
+
+	if len(existing) >= maxAPITokens {
+		tokensInfo.AddError("common", "storage has too many tokens, please revoke unused ones")
+		return "", nil
+	}
+
+	id, secret, value, err := newAPITokenValue()
+	if err != nil {
+		return "", httperror.NewInternalError("api token").WithError(err)
+	}
+
+	values := storageParameters{StorageName: sp.StorageName}.Values()
+	values.Add("scope", strings.Join(scopes, " "))
+	if !expiresAt.IsZero() {
+		values.Add("expires_at", strconv.FormatInt(expiresAt.Unix(), 10))
+	}
+
+	gatewayToken, httpErr := h.gw.IssueToken(r.Context(), h.gatewayParams(r, w, sp.StorageName, values))
+	if httpErr != nil {
+		return "", h.gatewayError(r, w, sp.StorageName, httpErr)
+	}
+
+	err = h.apiTokens.Save(APIToken{
+		ID:           id,
+		Storage:      sp.StorageName,
+		Label:        label,
+		Scopes:       scopes,
+		SecretHash:   hashAPITokenSecret(secret),
+		GatewayToken: gatewayToken,
+		CreatedAt:    time.Now(),
+		ExpiresAt:    expiresAt,
+	})
+	if err != nil {
+		return "", httperror.NewInternalError("save api token").WithError(err)
+	}
+
+	return value, nil
+}
+
+// RevokeAPITokenHandler removes personal api token of the storage
+func (h *Handler) RevokeAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	if h.apiTokens == nil {
+		h.Error(httperror.NewNotExistError("api tokens are disabled"), w, "RevokeAPITokenHandler")
+		return
+	}
+
+	sp, err := h.requestParameters(r)
+	if err != nil {
+		h.Error(httperror.NewInvalidParams("request parametes").WithError(err), w, "RevokeAPITokenHandler")
+		return
+	}
+
+	if err := h.apiTokens.Delete(sp.StorageName, r.FormValue("id")); err != nil {
+		h.Error(httperror.NewInternalError("revoke api token").WithError(err), w, "RevokeAPITokenHandler")
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/settings/%s/tokens/", sp.StorageName), http.StatusFound)
+}
+
+// deleteAPITokens removes all tokens of the deleted storage
+func (h *Handler) deleteAPITokens(storageName string) {
+	if h.apiTokens == nil {
+		return
+	}
+
+	if err := h.apiTokens.DeleteStorage(storageName); err != nil {
+		h.logger.WithError(err).
+			WithField("storage", storageName).
+			Error("unable to delete api tokens")
+	}
+}
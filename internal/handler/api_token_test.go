@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+// fakeTokenStore keeps personal api tokens in memory
+type fakeTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]APIToken
+}
+
+func newFakeTokenStore() *fakeTokenStore {
+	return &fakeTokenStore{tokens: make(map[string]APIToken)}
+}
+
+func (s *fakeTokenStore) Get(id string) (APIToken, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[id]
+	return t, ok, nil
+}
+
+func (s *fakeTokenStore) List(storage string) ([]APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tokens []APIToken
+	for _, t := range s.tokens {
+		if t.Storage == storage {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+func (s *fakeTokenStore) Save(t APIToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[t.ID] = t
+	return nil
+}
+
+func (s *fakeTokenStore) UpdateGatewayToken(id string, gatewayToken string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[id]
+	if !ok {
+		return false, nil
+	}
+	t.GatewayToken = gatewayToken
+	s.tokens[id] = t
+	return true, nil
+}
+
+func (s *fakeTokenStore) Delete(storage string, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.tokens[id]; ok && t.Storage == storage {
+		delete(s.tokens, id)
+	}
+	return nil
+}
+
+func (s *fakeTokenStore) DeleteStorage(storage string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, t := range s.tokens {
+		if t.Storage == storage {
+			delete(s.tokens, id)
+		}
+	}
+	return nil
+}
+
+// saveTestAPIToken stores read token of the storage and returns its bearer value
+func saveTestAPIToken(t *testing.T, store *fakeTokenStore, storage string, gatewayToken string) (string, string) {
+	t.Helper()
+
+	id, secret, value, err := newAPITokenValue()
+	if err != nil {
+		t.Fatalf("api token: %v", err)
+	}
+
+	store.Save(APIToken{
+		ID:           id,
+		Storage:      storage,
+		Label:        "ci",
+		Scopes:       []string{ScopeRead},
+		SecretHash:   hashAPITokenSecret(secret),
+		GatewayToken: gatewayToken,
+		CreatedAt:    time.Now(),
+	})
+	return id, value
+}
+
+func TestAPITokenGatewayTokenReissue(t *testing.T) {
+	tests := []struct {
+		name string
+		// revoke revokes the token while gateway is serving the request
+		revoke      bool
+		wantToken   bool
+		wantGateway string
+	}{
+		{name: "reissued token is kept", wantToken: true, wantGateway: "gw2"},
+		{name: "revoked in flight", revoke: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeTokenStore()
+			id, value := saveTestAPIToken(t, store, "s1", "gw1")
+
+			var h *Handler
+			gw := &fakeGateway{
+				list: func(p gateway.Params) ([]gateway.File, *httperror.Error) {
+					if tt.revoke {
+						w := httptest.NewRecorder()
+						r := httptest.NewRequest(http.MethodPost, "/settings/s1/tokens/revoke/?id="+id, nil)
+						h.RevokeAPITokenHandler(w, withRouterParameters(r, "s1", false, ""))
+						if w.Code != http.StatusFound {
+							t.Errorf("revoke status = %d", w.Code)
+						}
+					}
+					p.OnToken("gw2")
+					return []gateway.File{testFile}, nil
+				},
+			}
+			h = New(gw, newFakeSession(), nopLogger{}, WithAPITokens(store))
+
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/storages/s1/files/", nil)
+			r.Header.Set("Authorization", "Bearer "+value)
+
+			w := httptest.NewRecorder()
+			h.TokenScopeMiddleware(ScopeRead, http.HandlerFunc(h.APIListHandler)).
+				ServeHTTP(w, withRouterParameters(r, "s1", false, ""))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+
+			if got := gw.params[0].Token; got != "gw1" {
+				t.Errorf("gateway token = %q, want gw1", got)
+			}
+
+			if got := w.Header().Get("X-Token"); got != "" {
+				t.Errorf("gateway token is exposed to the api token owner: %q", got)
+			}
+
+			token, ok, _ := store.Get(id)
+			if ok != tt.wantToken {
+				t.Fatalf("token exists = %t, want %t", ok, tt.wantToken)
+			}
+
+			if ok && token.GatewayToken != tt.wantGateway {
+				t.Errorf("stored gateway token = %q, want %q", token.GatewayToken, tt.wantGateway)
+			}
+		})
+	}
+}
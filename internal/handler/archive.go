@@ -0,0 +1,241 @@
+package handler
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+const (
+	archiveFormatZip   = "zip"
+	archiveFormatTarGz = "tar.gz"
+)
+
+// archiveWriter writes files one by one into the archive stream
+type archiveWriter interface {
+	Add(f File, body io.Reader) error
+	Close() error
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchive) Add(f File, body io.Reader) error {
+	fw, err := a.zw.CreateHeader(&zip.FileHeader{
+		Name:     f.Name,
+		Method:   zip.Deflate,
+		Modified: time.Unix(f.ModTime, 0),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(fw, body)
+	return err
+}
+
+func (a *zipArchive) Close() error {
+	return a.zw.Close()
+}
+
+type tarGzArchive struct {
+	gw *gzip.Writer
+	tw *tar.Writer
+}
+
+// Add writes file into tar stream, tar header needs the size in advance
+// so the size from file list is used and the body is cut or rejected if it differs
+func (a *tarGzArchive) Add(f File, body io.Reader) error {
+	err := a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     f.Name,
+		Mode:     0644,
+		Size:     f.Size,
+		ModTime:  time.Unix(f.ModTime, 0),
+		Format:   tar.FormatPAX,
+	})
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(a.tw, io.LimitReader(body, f.Size))
+	if err != nil {
+		return err
+	}
+
+	if n != f.Size {
+		return fmt.Errorf("file %s: size changed: expected %d bytes got %d", f.Name, f.Size, n)
+	}
+	return nil
+}
+
+func (a *tarGzArchive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gw.Close()
+}
+
+func newArchiveWriter(format string, w io.Writer) archiveWriter {
+	if format == archiveFormatTarGz {
+		gw := gzip.NewWriter(w)
+		return &tarGzArchive{gw: gw, tw: tar.NewWriter(gw)}
+	}
+	return &zipArchive{zw: zip.NewWriter(w)}
+}
+
+// ArchiveHandler streams selected files or the whole folder as zip or tar.gz archive
+// files are fetched from gateway one by one and written directly to the response
+func (h *Handler) ArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	sp, err := h.requestParameters(r)
+	if err != nil {
+		h.Error(httperror.NewInvalidParams("request parametes").WithError(err), w, "ArchiveHandler")
+		return
+	}
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = archiveFormatZip
+	}
+
+	if format != archiveFormatZip && format != archiveFormatTarGz {
+		h.Error(httperror.NewInvalidParams("unsupported archive format"), w, "ArchiveHandler")
+		return
+	}
+
+	// files are fetched after response headers are sent so token reissued by gateway
+	// can not be stored in the session cookie anymore, the archive keeps the latest token itself
+	token := h.sessionToken(r, sp.StorageName)
+
+	files, httpErr := h.archiveFiles(r, w, sp, &token)
+	if httpErr != nil {
+		h.Error(httpErr, w, "ArchiveHandler")
+		return
+	}
+
+	name := sp.StorageName
+	if sp.IsPermanent {
+		name += "-permanent"
+	}
+
+	contentType := "application/zip"
+	if format == archiveFormatTarGz {
+		contentType = "application/gzip"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", name+"."+format))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	// response status is already sent, errors below can only be logged
+	// unfinished archive is left without the trailer so client sees it as broken
+	aw := newArchiveWriter(format, w)
+	for _, f := range files {
+		if err := r.Context().Err(); err != nil {
+			h.logger.WithError(err).
+				WithField("handler", "ArchiveHandler").
+				Warn("request canceled")
+			return
+		}
+
+		if err := h.archiveFile(r, sp, f, aw, &token); err != nil {
+			h.logger.WithError(err).
+				WithField("handler", "ArchiveHandler").
+				WithField("file", f.Name).
+				Error("unable to write archive")
+			return
+		}
+	}
+
+	if err := aw.Close(); err != nil {
+		h.logger.WithError(err).
+			WithField("handler", "ArchiveHandler").
+			Error("unable to close archive")
+	}
+}
+
+// archiveFiles returns files selected in the form or all files of the folder
+// the list is requested before response headers so reissued token is stored as usual and kept for the files
+func (h *Handler) archiveFiles(r *http.Request, w http.ResponseWriter, sp storageParameters, token *string) ([]File, *httperror.Error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, httperror.NewInvalidParams("invalid form").WithError(err)
+	}
+
+	params := h.gatewayParams(r, w, sp.StorageName, sp.Values())
+	store := params.OnToken
+	params.OnToken = func(t string) {
+		store(t)
+		*token = t
+	}
+
+	files, httpErr := h.gw.List(r.Context(), params)
+	if httpErr != nil {
+		return nil, h.gatewayError(r, w, sp.StorageName, httpErr)
+	}
+
+	selected := r.Form["file"]
+	if len(selected) == 0 {
+		if len(files) == 0 {
+			return nil, httperror.NewNotExistError("folder is empty")
+		}
+		return files, nil
+	}
+
+	byName := make(map[string]File, len(files))
+	for _, f := range files {
+		byName[f.Name] = f
+	}
+
+	result := make([]File, 0, len(selected))
+	added := make(map[string]bool, len(selected))
+	for _, name := range selected {
+		name, err := sanitizeFileName(name)
+		if err != nil {
+			return nil, httperror.NewInvalidParams("invalid file name").WithError(err)
+		}
+
+		f, ok := byName[name]
+		if !ok {
+			return nil, httperror.NewNotExistError(fmt.Sprintf("file %s not found", name))
+		}
+
+		if added[name] {
+			continue
+		}
+		added[name] = true
+		result = append(result, f)
+	}
+
+	return result, nil
+}
+
+// archiveFile writes file fetched by the latest token into the archive
+// token reissued here is used for the next files and kept server side for personal api tokens only
+func (h *Handler) archiveFile(r *http.Request, sp storageParameters, f File, aw archiveWriter, token *string) error {
+	sp.FileName = f.Name
+	rsp, httpErr := h.gw.File(r.Context(), gateway.Params{
+		Token:  *token,
+		Values: sp.Values(),
+		OnToken: func(t string) {
+			*token = t
+			if apiToken, ok := requestAPIToken(r); ok {
+				h.updateGatewayToken(apiToken, t)
+			}
+		},
+	})
+	if httpErr != nil {
+		return httpErr
+	}
+	defer rsp.Body.Close()
+
+	return aw.Add(f, rsp.Body)
+}
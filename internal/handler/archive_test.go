@@ -0,0 +1,286 @@
+package handler
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+var archiveContents = map[string]string{
+	"a.txt": "first file",
+	"b.txt": "second file",
+	"c.txt": "third file",
+}
+
+func archiveGateway() *fakeGateway {
+	return &fakeGateway{
+		list: func(p gateway.Params) ([]gateway.File, *httperror.Error) {
+			files := make([]gateway.File, 0, len(archiveContents))
+			for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+				files = append(files, gateway.File{Name: name, Size: int64(len(archiveContents[name])), ModTime: 1600000000})
+			}
+			return files, nil
+		},
+		file: func(p gateway.Params) (*http.Response, *httperror.Error) {
+			content, ok := archiveContents[p.Values.Get("file")]
+			if !ok {
+				return nil, httperror.NewNotExistError("file not found")
+			}
+			return fileResponse(http.StatusOK, "", content), nil
+		},
+	}
+}
+
+func archiveRequest(form url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/s1/archive/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return withRouterParameters(r, "s1", false, "")
+}
+
+func readZip(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		content, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func readTarGz(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("open gzip: %v", err)
+	}
+
+	files := make(map[string]string)
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read tar: %v", err)
+		}
+
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("read %s: %v", hdr.Name, err)
+		}
+		files[hdr.Name] = string(content)
+	}
+	return files
+}
+
+func TestArchiveHandler(t *testing.T) {
+	tests := []struct {
+		name            string
+		form            url.Values
+		wantType        string
+		wantDisposition string
+		read            func(t *testing.T, data []byte) map[string]string
+		wantFiles       []string
+	}{
+		{
+			name:            "zip of folder",
+			form:            url.Values{},
+			wantType:        "application/zip",
+			wantDisposition: `attachment; filename="s1.zip"`,
+			read:            readZip,
+			wantFiles:       []string{"a.txt", "b.txt", "c.txt"},
+		},
+		{
+			name:            "tar.gz of folder",
+			form:            url.Values{"format": {"tar.gz"}},
+			wantType:        "application/gzip",
+			wantDisposition: `attachment; filename="s1.tar.gz"`,
+			read:            readTarGz,
+			wantFiles:       []string{"a.txt", "b.txt", "c.txt"},
+		},
+		{
+			name:            "zip of selected files",
+			form:            url.Values{"file": {"c.txt", "a.txt", "c.txt"}},
+			wantType:        "application/zip",
+			wantDisposition: `attachment; filename="s1.zip"`,
+			read:            readZip,
+			wantFiles:       []string{"c.txt", "a.txt"},
+		},
+		{
+			name:            "tar.gz of selected files",
+			form:            url.Values{"format": {"tar.gz"}, "file": {"b.txt"}},
+			wantType:        "application/gzip",
+			wantDisposition: `attachment; filename="s1.tar.gz"`,
+			read:            readTarGz,
+			wantFiles:       []string{"b.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := archiveGateway()
+			session := newFakeSession()
+			session.tokens["s1"] = &Token{Value: "token"}
+			h := New(gw, session, nopLogger{})
+
+			w := httptest.NewRecorder()
+			h.ArchiveHandler(w, archiveRequest(tt.form))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+
+			if got := w.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("content type = %q, want %q", got, tt.wantType)
+			}
+
+			if got := w.Header().Get("Content-Disposition"); got != tt.wantDisposition {
+				t.Errorf("content disposition = %q, want %q", got, tt.wantDisposition)
+			}
+
+			files := tt.read(t, w.Body.Bytes())
+			if len(files) != len(tt.wantFiles) {
+				t.Fatalf("archive files = %v, want %v", files, tt.wantFiles)
+			}
+
+			for _, name := range tt.wantFiles {
+				if files[name] != archiveContents[name] {
+					t.Errorf("file %s = %q, want %q", name, files[name], archiveContents[name])
+				}
+			}
+		})
+	}
+}
+
+func TestArchiveHandlerErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		form       url.Values
+		wantStatus int
+	}{
+		{name: "unknown format", form: url.Values{"format": {"rar"}}, wantStatus: http.StatusUnprocessableEntity},
+		{name: "missing file", form: url.Values{"file": {"missing.txt"}}, wantStatus: http.StatusNotFound},
+		{name: "invalid file name", form: url.Values{"file": {"../a.txt"}}, wantStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := archiveGateway()
+			session := newFakeSession()
+			session.tokens["s1"] = &Token{Value: "token"}
+			h := New(gw, session, nopLogger{})
+
+			w := httptest.NewRecorder()
+			h.ArchiveHandler(w, archiveRequest(tt.form))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if gw.called("file") != 0 {
+				t.Errorf("files are fetched for rejected archive")
+			}
+		})
+	}
+}
+
+func TestArchiveHandlerReissuedTokens(t *testing.T) {
+	gw := archiveGateway()
+	list, file := gw.list, gw.file
+	gw.list = func(p gateway.Params) ([]gateway.File, *httperror.Error) {
+		p.OnToken("listed")
+		return list(p)
+	}
+	gw.file = func(p gateway.Params) (*http.Response, *httperror.Error) {
+		if p.Values.Get("file") == "a.txt" {
+			p.OnToken("streamed")
+		}
+		return file(p)
+	}
+
+	session := newFakeSession()
+	session.tokens["s1"] = &Token{Value: "token"}
+	h := New(gw, session, nopLogger{})
+
+	w := httptest.NewRecorder()
+	h.ArchiveHandler(w, archiveRequest(url.Values{}))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	var tokens []string
+	for i, c := range gw.calls {
+		if c == "file" {
+			tokens = append(tokens, gw.params[i].Token)
+		}
+	}
+
+	// token reissued by the list is used for files, token reissued while streaming is used for the rest
+	if strings.Join(tokens, ",") != "listed,streamed,streamed" {
+		t.Fatalf("file tokens = %v, want [listed streamed streamed]", tokens)
+	}
+
+	// session is updated before response headers only
+	if got := session.tokens["s1"].Value; got != "listed" {
+		t.Errorf("session token = %q, want listed", got)
+	}
+
+	if len(readZip(t, w.Body.Bytes())) != len(archiveContents) {
+		t.Errorf("archive is incomplete")
+	}
+}
+
+func TestArchiveHandlerReissuedAPIToken(t *testing.T) {
+	gw := archiveGateway()
+	file := gw.file
+	gw.file = func(p gateway.Params) (*http.Response, *httperror.Error) {
+		p.OnToken("streamed")
+		return file(p)
+	}
+
+	store := newFakeTokenStore()
+	id, value := saveTestAPIToken(t, store, "s1", "gw1")
+	h := New(gw, newFakeSession(), nopLogger{}, WithAPITokens(store))
+
+	r := archiveRequest(url.Values{"file": {"a.txt"}})
+	r.Header.Set("Authorization", "Bearer "+value)
+
+	w := httptest.NewRecorder()
+	h.TokenScopeMiddleware(ScopeRead, http.HandlerFunc(h.ArchiveHandler)).ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	if token, _, _ := store.Get(id); token.GatewayToken != "streamed" {
+		t.Errorf("stored gateway token = %q, want streamed", token.GatewayToken)
+	}
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+const maxBulkFiles = 1000
+
+// fileResult is the outcome of bulk operation for the single file
+type fileResult struct {
+	Name    string `json:"name"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+type bulkResponse struct {
+	Results []fileResult `json:"results"`
+}
+
+// bulkFileNames returns unique file names from repeated fileName form values
+func bulkFileNames(r *http.Request) ([]string, *httperror.Error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, httperror.NewInvalidParams("invalid form").WithError(err)
+	}
+
+	values := r.Form["fileName"]
+	if len(values) == 0 {
+		return nil, httperror.NewInvalidParams("file name was not set")
+	}
+
+	if len(values) > maxBulkFiles {
+		return nil, httperror.NewInvalidParams("too many files")
+	}
+
+	names := make([]string, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		name, err := sanitizeFileName(v)
+		if err != nil {
+			return nil, httperror.NewInvalidParams("invalid file name").WithError(err)
+		}
+
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// bulkFiles applies fn to every file and collects per file results
+// unauthorized error stops the whole operation because the rest would fail the same way
+func (h *Handler) bulkFiles(r *http.Request, names []string, fn func(name string) *httperror.Error) (bulkResponse, *httperror.Error) {
+	rsp := bulkResponse{Results: make([]fileResult, 0, len(names))}
+	for _, name := range names {
+		if err := r.Context().Err(); err != nil {
+			return bulkResponse{}, httperror.NewInternalError("request canceled").WithError(err)
+		}
+
+		httpErr := fn(name)
+		if httpErr != nil && httpErr.Code == httperror.CodeUnauthorized {
+			return bulkResponse{}, httpErr
+		}
+
+		result := fileResult{Name: name, Success: httpErr == nil}
+		if httpErr != nil {
+			h.logger.WithError(httpErr).
+				WithField("file", name).
+				Warn("bulk operation failed")
+			result.Error = httpErr.Description
+		}
+		rsp.Results = append(rsp.Results, result)
+	}
+
+	return rsp, nil
+}
@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+func bulkRequest(path string, names ...string) *http.Request {
+	form := url.Values{"fileName": names}
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-Requested-With", "XMLHttpRequest")
+	return r
+}
+
+func decodeBulkResponse(t *testing.T, w *httptest.ResponseRecorder) []fileResult {
+	t.Helper()
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	var rsp bulkResponse
+	if err := json.NewDecoder(w.Body).Decode(&rsp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return rsp.Results
+}
+
+func checkResults(t *testing.T, results []fileResult, want map[string]bool) {
+	t.Helper()
+
+	if len(results) != len(want) {
+		t.Fatalf("results = %+v, want %d files", results, len(want))
+	}
+
+	for _, res := range results {
+		success, ok := want[res.Name]
+		if !ok {
+			t.Errorf("unexpected result %+v", res)
+			continue
+		}
+
+		if res.Success != success || (res.Error == "") != success {
+			t.Errorf("result %+v, want success %t", res, success)
+		}
+	}
+}
+
+func TestRemoveHandler(t *testing.T) {
+	gw := &fakeGateway{
+		remove: func(p gateway.Params) *httperror.Error {
+			if p.Values.Get("file") == "missing.txt" {
+				return httperror.NewNotExistError("file not found")
+			}
+			return nil
+		},
+	}
+	session := newFakeSession()
+	session.tokens["s1"] = &Token{Value: "token"}
+	h := New(gw, session, nopLogger{})
+
+	w := httptest.NewRecorder()
+	h.RemoveHandler(w, withRouterParameters(bulkRequest("/s1/remove/", "a.txt", "missing.txt", "a.txt", "b.txt"), "s1", false, ""))
+
+	checkResults(t, decodeBulkResponse(t, w), map[string]bool{
+		"a.txt":       true,
+		"missing.txt": false,
+		"b.txt":       true,
+	})
+
+	if n := gw.called("remove"); n != 3 {
+		t.Errorf("gateway remove calls = %d, want 3", n)
+	}
+}
+
+func TestBulkHandlersStopOnUnauthorized(t *testing.T) {
+	gw := &fakeGateway{
+		remove: func(p gateway.Params) *httperror.Error {
+			return httperror.NewUnauthorized("token is expired")
+		},
+	}
+	session := newFakeSession()
+	session.tokens["s1"] = &Token{Value: "token"}
+	h := New(gw, session, nopLogger{})
+
+	w := httptest.NewRecorder()
+	h.RemoveHandler(w, withRouterParameters(bulkRequest("/s1/remove/", "a.txt", "b.txt"), "s1", false, ""))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	if n := gw.called("remove"); n != 1 {
+		t.Errorf("gateway remove calls = %d, want 1", n)
+	}
+}
+
+func TestBulkHandlersInvalidRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(h *Handler) http.HandlerFunc
+		r       *http.Request
+	}{
+		{
+			name:    "remove without files",
+			handler: func(h *Handler) http.HandlerFunc { return h.RemoveHandler },
+			r:       withRouterParameters(bulkRequest("/s1/remove/"), "s1", false, ""),
+		},
+		{
+			name:    "remove with invalid router parameters",
+			handler: func(h *Handler) http.HandlerFunc { return h.RemoveHandler },
+			r:       withRouterParameters(bulkRequest("/s1/remove/", "a.txt"), "s1", false, "../a.txt"),
+		},
+		{
+			name:    "move with invalid router parameters",
+			handler: func(h *Handler) http.HandlerFunc { return h.MoveToPermanentHandler },
+			r:       withRouterParameters(bulkRequest("/s1/move/", "a.txt"), "s1", false, "../a.txt"),
+		},
+		{
+			name:    "move from permanent folder",
+			handler: func(h *Handler) http.HandlerFunc { return h.MoveToPermanentHandler },
+			r:       withRouterParameters(bulkRequest("/s1/permanent/move/", "a.txt"), "s1", true, ""),
+		},
+		{
+			name:    "move invalid file name",
+			handler: func(h *Handler) http.HandlerFunc { return h.MoveToPermanentHandler },
+			r:       withRouterParameters(bulkRequest("/s1/move/", "../a.txt"), "s1", false, ""),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &fakeGateway{}
+			h := New(gw, newFakeSession(), nopLogger{})
+
+			w := httptest.NewRecorder()
+			tt.handler(h)(w, tt.r)
+
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusUnprocessableEntity, w.Body.String())
+			}
+
+			if len(gw.calls) != 0 {
+				t.Errorf("gateway calls = %v, want none", gw.calls)
+			}
+		})
+	}
+}
+
+func TestMoveToPermanentHandler(t *testing.T) {
+	contents := map[string]string{
+		"a.txt":      "first file",
+		"broken.txt": "copy fails",
+	}
+
+	uploaded := make(map[string]string)
+	gw := &fakeGateway{
+		file: func(p gateway.Params) (*http.Response, *httperror.Error) {
+			content, ok := contents[p.Values.Get("file")]
+			if !ok {
+				return nil, httperror.NewNotExistError("file not found")
+			}
+			return fileResponse(http.StatusOK, "", content), nil
+		},
+		upload: func(p gateway.Params, body io.Reader, contentType string) *httperror.Error {
+			if p.Values.Get("permanent") != "true" {
+				return httperror.NewInvalidParams("upload to temporary folder")
+			}
+
+			_, params, err := mime.ParseMediaType(contentType)
+			if err != nil {
+				return httperror.NewInvalidParams("content type").WithError(err)
+			}
+
+			part, err := multipart.NewReader(body, params["boundary"]).NextPart()
+			if err != nil {
+				return httperror.NewInvalidParams("multipart").WithError(err)
+			}
+
+			data, _ := ioutil.ReadAll(part)
+			if part.FileName() == "broken.txt" {
+				return httperror.NewInternalError("storage is full")
+			}
+
+			uploaded[part.FileName()] = string(data)
+			return nil
+		},
+		remove: func(p gateway.Params) *httperror.Error {
+			return nil
+		},
+	}
+	session := newFakeSession()
+	session.tokens["s1"] = &Token{Value: "token"}
+	h := New(gw, session, nopLogger{})
+
+	w := httptest.NewRecorder()
+	h.MoveToPermanentHandler(w, withRouterParameters(bulkRequest("/s1/move/", "a.txt", "broken.txt", "missing.txt"), "s1", false, ""))
+
+	checkResults(t, decodeBulkResponse(t, w), map[string]bool{
+		"a.txt":       true,
+		"broken.txt":  false,
+		"missing.txt": false,
+	})
+
+	if uploaded["a.txt"] != contents["a.txt"] {
+		t.Errorf("permanent copy = %q, want %q", uploaded["a.txt"], contents["a.txt"])
+	}
+
+	// original is removed only after successful copy
+	var removed []string
+	for i, c := range gw.calls {
+		if c == "remove" {
+			if gw.params[i].Values.Get("permanent") == "true" {
+				t.Errorf("file is removed from permanent folder")
+			}
+			removed = append(removed, gw.params[i].Values.Get("file"))
+		}
+	}
+
+	if strings.Join(removed, ",") != "a.txt" {
+		t.Errorf("removed files = %v, want [a.txt]", removed)
+	}
+}
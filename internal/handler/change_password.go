@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/template"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+// ChangePasswordHandler changes password of the signed in storage
+// all sessions of the storage are closed after password change
+func (h *Handler) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	sp, err := h.requestParameters(r)
+	if err != nil {
+		h.Error(httperror.NewInvalidParams("request parametes").WithError(err), w, "ChangePasswordHandler")
+		return
+	}
+
+	passwordInfo := template.NewTemplateChangePassword(Title, sp.StorageName)
+	passwordInfo.CSRFToken = csrfToken(r)
+	renderTemplate := true
+	defer func() {
+		if renderTemplate {
+			if err := passwordInfo.Execute(w); err != nil {
+				h.logger.Error(err)
+			}
+		}
+	}()
+
+	if r.Method != http.MethodPost {
+		return
+	}
+
+	password := r.FormValue("password")
+	newPassword := r.FormValue("new_password")
+
+	if password == "" {
+		passwordInfo.AddError("password", "please enter current password")
+		return
+	}
+
+	if newPassword != r.FormValue("confirm") {
+		passwordInfo.AddError("confirm", "passwords do not match")
+		return
+	}
+
+	if err := h.passwordPolicy.Validate(sp.StorageName, newPassword); err != nil {
+		passwordInfo.AddError("new_password", "%s", err)
+		return
+	}
+
+	values := sp.Values()
+	values.Add("password", password)
+	values.Add("new_password", newPassword)
+
+	if httpErr := h.gw.ChangePassword(r.Context(), h.gatewayParams(r, w, sp.StorageName, values)); httpErr != nil {
+		switch httpErr.Code {
+		case httperror.CodeNotMatch:
+			passwordInfo.AddError("password", "invalid current password")
+		default:
+			renderTemplate = false
+			h.Error(h.gatewayError(r, w, sp.StorageName, httpErr), w, "ChangePasswordHandler")
+		}
+		return
+	}
+
+	h.closeSessions(w, r, sp.StorageName)
+
+	renderTemplate = false
+	http.Redirect(w, r, fmt.Sprintf("/login/%s/", sp.StorageName), http.StatusFound)
+}
+
+// closeSessions signs out storage from the current browser and from all others if session store supports it
+func (h *Handler) closeSessions(w http.ResponseWriter, r *http.Request, storageName string) {
+	if revoker, ok := h.session.(Revoker); ok {
+		if err := revoker.RevokeStorage(storageName); err != nil {
+			h.logger.WithError(err).
+				WithField("storage", storageName).
+				Error("unable to revoke sessions")
+		}
+	}
+
+	h.session.Remove(w, r, storageName)
+}
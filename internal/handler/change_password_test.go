@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+// revokingSession records storages signed out from all browsers
+type revokingSession struct {
+	*fakeSession
+	revoked   []string
+	revokeErr error
+}
+
+func (s *revokingSession) RevokeStorage(name string) error {
+	s.revoked = append(s.revoked, name)
+	return s.revokeErr
+}
+
+func changePasswordRequest(form url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/settings/s1/password/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return withRouterParameters(r, "s1", false, "")
+}
+
+func TestChangePasswordHandlerClosesSessions(t *testing.T) {
+	tests := []struct {
+		name      string
+		revokeErr error
+	}{
+		{name: "revoked"},
+		{name: "revoke failure still signs out", revokeErr: errors.New("store is unavailable")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &fakeGateway{
+				storageFn: func(endpoint string, p gateway.Params) *httperror.Error {
+					return nil
+				},
+			}
+			session := &revokingSession{fakeSession: newFakeSession(), revokeErr: tt.revokeErr}
+			session.tokens["s1"] = &Token{Value: "t1"}
+			session.tokens["s2"] = &Token{Value: "t2"}
+			h := New(gw, session, nopLogger{})
+
+			w := httptest.NewRecorder()
+			h.ChangePasswordHandler(w, changePasswordRequest(url.Values{
+				"password":     {"old-Passw0rd"},
+				"new_password": {"Tr1cky-passphrase"},
+				"confirm":      {"Tr1cky-passphrase"},
+			}))
+
+			if w.Code != http.StatusFound || w.Header().Get("Location") != "/login/s1/" {
+				t.Fatalf("status = %d, location = %q, want redirect to login", w.Code, w.Header().Get("Location"))
+			}
+
+			values := gw.params[0].Values
+			if values.Get("password") != "old-Passw0rd" || values.Get("new_password") != "Tr1cky-passphrase" || gw.params[0].Token != "t1" {
+				t.Errorf("gateway params = %+v", gw.params[0])
+			}
+
+			if len(session.revoked) != 1 || session.revoked[0] != "s1" {
+				t.Errorf("revoked storages = %v, want [s1]", session.revoked)
+			}
+
+			if _, ok := session.tokens["s1"]; ok {
+				t.Errorf("storage is not signed out in the current browser")
+			}
+
+			if _, ok := session.tokens["s2"]; !ok {
+				t.Errorf("other storage is signed out")
+			}
+		})
+	}
+}
+
+func TestChangePasswordHandlerKeepsSessions(t *testing.T) {
+	tests := []struct {
+		name       string
+		form       url.Values
+		gatewayErr *httperror.Error
+		wantCalls  int
+		wantError  string
+	}{
+		{
+			name:      "confirmation mismatch",
+			form:      url.Values{"password": {"old-Passw0rd"}, "new_password": {"Tr1cky-passphrase"}, "confirm": {"other"}},
+			wantError: "passwords do not match",
+		},
+		{
+			name:      "weak password",
+			form:      url.Values{"password": {"old-Passw0rd"}, "new_password": {"short"}, "confirm": {"short"}},
+			wantError: "weak password",
+		},
+		{
+			name:       "wrong current password",
+			form:       url.Values{"password": {"wrong"}, "new_password": {"Tr1cky-passphrase"}, "confirm": {"Tr1cky-passphrase"}},
+			gatewayErr: httperror.NewNotMatchError("password does not match"),
+			wantCalls:  1,
+			wantError:  "invalid current password",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &fakeGateway{
+				storageFn: func(endpoint string, p gateway.Params) *httperror.Error {
+					return tt.gatewayErr
+				},
+			}
+			session := &revokingSession{fakeSession: newFakeSession()}
+			session.tokens["s1"] = &Token{Value: "t1"}
+			h := New(gw, session, nopLogger{})
+
+			w := httptest.NewRecorder()
+			h.ChangePasswordHandler(w, changePasswordRequest(tt.form))
+
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), tt.wantError) {
+				t.Fatalf("status = %d, want form with %q error", w.Code, tt.wantError)
+			}
+
+			if n := gw.called("changePassword"); n != tt.wantCalls {
+				t.Errorf("gateway changePassword calls = %d, want %d", n, tt.wantCalls)
+			}
+
+			if len(session.revoked) != 0 || session.tokens["s1"] == nil {
+				t.Errorf("sessions are closed: revoked = %v", session.revoked)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+const (
+	sniffLen = 512
+
+	defaultContentType = "application/octet-stream"
+	plainTextType      = "text/plain; charset=utf-8"
+
+	// inlineCSP forbids any script or plugin execution for previewed files
+	inlineCSP = "default-src 'none'; img-src 'self'; media-src 'self'; style-src 'unsafe-inline'"
+)
+
+var (
+	inlineTypes = map[string]bool{
+		"image/png":       true,
+		"image/jpeg":      true,
+		"image/gif":       true,
+		"image/webp":      true,
+		"image/bmp":       true,
+		"application/pdf": true,
+		"video/mp4":       true,
+		"video/webm":      true,
+		"video/ogg":       true,
+		"audio/mpeg":      true,
+		"audio/ogg":       true,
+		"audio/wav":       true,
+		"audio/webm":      true,
+	}
+
+	// scriptTypes may execute script when rendered by the browser
+	scriptTypes = map[string]bool{
+		"text/html":              true,
+		"text/xml":               true,
+		"text/javascript":        true,
+		"application/xml":        true,
+		"application/xhtml+xml":  true,
+		"application/javascript": true,
+		"image/svg+xml":          true,
+	}
+)
+
+// fileContentType detects content type by file extension or by content if extension is unknown
+// sniff returns first bytes of the file or nil if they are not available
+func fileContentType(name string, sniff func() []byte) string {
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		return ct
+	}
+
+	if data := sniff(); len(data) > 0 {
+		return http.DetectContentType(data)
+	}
+
+	return defaultContentType
+}
+
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mt
+}
+
+// inlineContentType returns content type to serve file inline with
+// false means that file could run script and must be downloaded as attachment
+func inlineContentType(contentType string) (string, bool) {
+	mt := mediaType(contentType)
+	if scriptTypes[mt] {
+		return "", false
+	}
+
+	if inlineTypes[mt] {
+		return mt, true
+	}
+
+	if strings.HasPrefix(mt, "text/") || mt == "application/json" {
+		return plainTextType, true
+	}
+
+	return "", false
+}
+
+// attachmentContentType hides script types behind generic binary type
+func attachmentContentType(contentType string) string {
+	if mt := mediaType(contentType); mt == "" || scriptTypes[mt] {
+		return defaultContentType
+	}
+	return contentType
+}
+
+func setInlineHeaders(w http.ResponseWriter, contentType string) {
+	csp := inlineCSP
+	if contentType != "application/pdf" {
+		// browsers' pdf viewers do not work in sandboxed documents
+		csp += "; sandbox"
+	}
+	w.Header().Set("Content-Security-Policy", csp)
+}
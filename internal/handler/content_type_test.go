@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+func TestGetFileHandlerInlinePreview(t *testing.T) {
+	sandboxCSP := inlineCSP + "; sandbox"
+
+	tests := []struct {
+		name            string
+		file            string
+		content         string
+		query           string
+		wantType        string
+		wantDisposition string
+		wantCSP         string
+	}{
+		{
+			name:            "image",
+			file:            "a.png",
+			content:         "\x89PNG\r\n\x1a\n",
+			query:           "?inline=1",
+			wantType:        "image/png",
+			wantDisposition: `inline; filename="a.png"`,
+			wantCSP:         sandboxCSP,
+		},
+		{
+			name:            "pdf is not sandboxed",
+			file:            "a.pdf",
+			content:         "%PDF-1.4",
+			query:           "?inline=1",
+			wantType:        "application/pdf",
+			wantDisposition: `inline; filename="a.pdf"`,
+			wantCSP:         inlineCSP,
+		},
+		{
+			name:            "text is shown as plain text",
+			file:            "a.csv",
+			content:         "a,b",
+			query:           "?inline=1",
+			wantType:        plainTextType,
+			wantDisposition: `inline; filename="a.csv"`,
+			wantCSP:         sandboxCSP,
+		},
+		{
+			name:            "html is downloaded",
+			file:            "a.html",
+			content:         "<script>alert(1)</script>",
+			query:           "?inline=1",
+			wantType:        defaultContentType,
+			wantDisposition: `attachment; filename="a.html"`,
+		},
+		{
+			name:            "svg is downloaded",
+			file:            "a.svg",
+			content:         "<svg onload=alert(1)/>",
+			query:           "?inline=1",
+			wantType:        defaultContentType,
+			wantDisposition: `attachment; filename="a.svg"`,
+		},
+		{
+			name:            "sniffed html is downloaded",
+			file:            "noext",
+			content:         "<html><script>alert(1)</script></html>",
+			query:           "?inline=1",
+			wantType:        defaultContentType,
+			wantDisposition: `attachment; filename="noext"`,
+		},
+		{
+			name:            "image without inline mode",
+			file:            "a.png",
+			content:         "\x89PNG\r\n\x1a\n",
+			wantType:        "image/png",
+			wantDisposition: `attachment; filename="a.png"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &fakeGateway{
+				list: func(p gateway.Params) ([]gateway.File, *httperror.Error) {
+					return []gateway.File{{Name: tt.file, Size: int64(len(tt.content)), ModTime: 1600000000}}, nil
+				},
+				file: func(p gateway.Params) (*http.Response, *httperror.Error) {
+					return fileResponse(http.StatusOK, "", tt.content), nil
+				},
+			}
+			h := New(gw, newFakeSession(), nopLogger{})
+
+			r := httptest.NewRequest(http.MethodGet, "/s1/"+tt.file+"/"+tt.query, nil)
+			w := httptest.NewRecorder()
+			h.GetFileHandler(w, withRouterParameters(r, "s1", false, tt.file))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+
+			if got := w.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("content type = %q, want %q", got, tt.wantType)
+			}
+
+			if got := w.Header().Get("Content-Disposition"); got != tt.wantDisposition {
+				t.Errorf("content disposition = %q, want %q", got, tt.wantDisposition)
+			}
+
+			if got := w.Header().Get("Content-Security-Policy"); got != tt.wantCSP {
+				t.Errorf("content security policy = %q, want %q", got, tt.wantCSP)
+			}
+
+			if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("x-content-type-options = %q", got)
+			}
+
+			if !strings.Contains(w.Body.String(), tt.content) {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.content)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+const (
+	// CSRFCookieName name of the cookie with csrf token, it is not a storage session
+	CSRFCookieName = "csrf_token"
+	// CSRFHeaderName header used by scripts to send csrf token
+	CSRFHeaderName = "X-CSRF-Token"
+	// CSRFFormField form field used by html forms to send csrf token
+	CSRFFormField = "csrf_token"
+
+	csrfTokenLength = 32
+)
+
+var (
+	// ErrCSRFToken indicates missing or invalid csrf token
+	ErrCSRFToken = errors.New("invalid csrf token")
+)
+
+type csrfContextKey struct{}
+
+// CSRFError indicates that state changing request was rejected by csrf protection
+type CSRFError struct {
+	Err error
+}
+
+func (e *CSRFError) Error() string {
+	return fmt.Sprintf("csrf: %v", e.Err)
+}
+
+func (e *CSRFError) Unwrap() error {
+	return e.Err
+}
+
+// WithCSRFCookieSecure sets secure attribute of csrf cookie
+func WithCSRFCookieSecure(secure bool) Option {
+	return func(h *Handler) {
+		h.csrfSecure = secure
+	}
+}
+
+// CSRFMiddleware implements double submit cookie protection
+// every response gets csrf cookie, state changing requests must repeat its value in header or form field
+// requests authorized by bearer token are not exposed to csrf and skip the check,
+// session only routes reject bearer tokens before this middleware so the check can not be bypassed there
+func (h *Handler) CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookieToken := ""
+		if cook, err := r.Cookie(CSRFCookieName); err == nil {
+			cookieToken = cook.Value
+		}
+
+		if !isSafeMethod(r.Method) && bearerToken(r) == "" {
+			if err := checkCSRFToken(r, cookieToken); err != nil {
+				h.Error(httperror.NewUnauthorized("csrf token mismatch").WithError(&CSRFError{Err: err}), w, "CSRFMiddleware")
+				return
+			}
+		}
+
+		if cookieToken == "" {
+			token, err := newCSRFToken()
+			if err != nil {
+				h.Error(httperror.NewInternalError("csrf token").WithError(err), w, "CSRFMiddleware")
+				return
+			}
+
+			cookieToken = token
+			http.SetCookie(w, &http.Cookie{
+				Name:     CSRFCookieName,
+				Value:    cookieToken,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   h.csrfSecure,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfContextKey{}, cookieToken)))
+	})
+}
+
+// csrfToken returns csrf token for rendering into templates
+func csrfToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfContextKey{}).(string)
+	return token
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// checkCSRFToken compares request token with cookie one
+// form field is read for urlencoded bodies only so multipart uploads are not buffered
+func checkCSRFToken(r *http.Request, cookieToken string) error {
+	if cookieToken == "" {
+		return fmt.Errorf("cookie is missing: %w", ErrCSRFToken)
+	}
+
+	token := r.Header.Get(CSRFHeaderName)
+	if token == "" {
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" {
+			token = r.PostFormValue(CSRFFormField)
+		}
+	}
+
+	if token == "" {
+		return fmt.Errorf("token is missing: %w", ErrCSRFToken)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(token), []byte(cookieToken)) != 1 {
+		return ErrCSRFToken
+	}
+
+	return nil
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, csrfTokenLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("random: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
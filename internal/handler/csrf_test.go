@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testCSRFToken = "csrf-token"
+
+func TestCSRFMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		cookie string
+		header map[string]string
+		form   url.Values
+		want   int
+	}{
+		{name: "safe method", method: http.MethodGet, want: http.StatusOK},
+		{name: "missing cookie", method: http.MethodPost, header: map[string]string{CSRFHeaderName: testCSRFToken}, want: http.StatusForbidden},
+		{name: "missing token", method: http.MethodPost, cookie: testCSRFToken, want: http.StatusForbidden},
+		{name: "header mismatch", method: http.MethodPost, cookie: testCSRFToken, header: map[string]string{CSRFHeaderName: "forged"}, want: http.StatusForbidden},
+		{name: "form mismatch", method: http.MethodPost, cookie: testCSRFToken, form: url.Values{CSRFFormField: {"forged"}}, want: http.StatusForbidden},
+		{name: "header match", method: http.MethodPost, cookie: testCSRFToken, header: map[string]string{CSRFHeaderName: testCSRFToken}, want: http.StatusOK},
+		{name: "form match", method: http.MethodPost, cookie: testCSRFToken, form: url.Values{CSRFFormField: {testCSRFToken}}, want: http.StatusOK},
+		{name: "bearer token", method: http.MethodPost, header: map[string]string{"Authorization": "Bearer token"}, want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&fakeGateway{}, newFakeSession(), nopLogger{})
+
+			var gotToken string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotToken = csrfToken(r)
+			})
+
+			var r *http.Request
+			if tt.form != nil {
+				r = httptest.NewRequest(tt.method, "/s1/", strings.NewReader(tt.form.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				r = httptest.NewRequest(tt.method, "/s1/", nil)
+			}
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: tt.cookie})
+			}
+
+			w := httptest.NewRecorder()
+			h.CSRFMiddleware(next).ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+
+			if tt.want == http.StatusOK && gotToken == "" {
+				t.Errorf("csrf token is not passed to the handler")
+			}
+
+			if tt.cookie != "" && tt.want == http.StatusOK && gotToken != tt.cookie {
+				t.Errorf("csrf token = %q, want cookie value %q", gotToken, tt.cookie)
+			}
+		})
+	}
+}
+
+func TestCSRFMiddlewareCookie(t *testing.T) {
+	for _, secure := range []bool{false, true} {
+		h := New(&fakeGateway{}, newFakeSession(), nopLogger{}, WithCSRFCookieSecure(secure))
+
+		w := httptest.NewRecorder()
+		h.CSRFMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+			ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/s1/", nil))
+
+		var cookie *http.Cookie
+		for _, c := range w.Result().Cookies() {
+			if c.Name == CSRFCookieName {
+				cookie = c
+			}
+		}
+
+		if cookie == nil || cookie.Value == "" {
+			t.Fatalf("csrf cookie is not issued")
+		}
+
+		if cookie.Secure != secure || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+			t.Errorf("cookie attributes = %+v, want secure %t, http only and same site lax", cookie, secure)
+		}
+	}
+}
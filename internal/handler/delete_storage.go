@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/template"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+// DeleteStorageHandler removes signed in storage with all files
+// user should type storage name to confirm removal
+func (h *Handler) DeleteStorageHandler(w http.ResponseWriter, r *http.Request) {
+	sp, err := h.requestParameters(r)
+	if err != nil {
+		h.Error(httperror.NewInvalidParams("request parametes").WithError(err), w, "DeleteStorageHandler")
+		return
+	}
+
+	deleteInfo := template.NewTemplateDeleteStorage(Title, sp.StorageName)
+	deleteInfo.CSRFToken = csrfToken(r)
+	renderTemplate := true
+	defer func() {
+		if renderTemplate {
+			if err := deleteInfo.Execute(w); err != nil {
+				h.logger.Error(err)
+			}
+		}
+	}()
+
+	if r.Method != http.MethodPost {
+		return
+	}
+
+	if r.FormValue("confirm") != sp.StorageName {
+		deleteInfo.AddError("confirm", "storage name does not match")
+		return
+	}
+
+	password := r.FormValue("password")
+	if password == "" {
+		deleteInfo.AddError("password", "please enter password")
+		return
+	}
+
+	values := sp.Values()
+	values.Add("password", password)
+
+	if httpErr := h.gw.DeleteStorage(r.Context(), h.gatewayParams(r, w, sp.StorageName, values)); httpErr != nil {
+		switch httpErr.Code {
+		case httperror.CodeNotMatch:
+			deleteInfo.AddError("password", "invalid password")
+		default:
+			renderTemplate = false
+			h.Error(h.gatewayError(r, w, sp.StorageName, httpErr), w, "DeleteStorageHandler")
+		}
+		return
+	}
+
+	h.closeSessions(w, r, sp.StorageName)
+	h.deleteAPITokens(sp.StorageName)
+	h.deleteShareLinks(sp.StorageName)
+
+	renderTemplate = false
+	http.Redirect(w, r, "/storages/", http.StatusFound)
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errRangeNotSatisfiable = errors.New("range not satisfiable")
+)
+
+// byteRange represents single requested range of the file
+type byteRange struct {
+	Start  int64
+	Length int64
+}
+
+func (br byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", br.Start, br.Start+br.Length-1, size)
+}
+
+func (br byteRange) header() string {
+	return fmt.Sprintf("bytes=%d-%d", br.Start, br.Start+br.Length-1)
+}
+
+// parseRange parses Range header value for the file with specified size
+// nil range means whole file should be served(no header, unknown unit or multiple ranges which are not supported)
+func parseRange(value string, size int64) (*byteRange, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	// unknown range unit must be ignored, RFC 7233 section 3.1
+	const prefix = "bytes="
+	if !strings.HasPrefix(value, prefix) {
+		return nil, nil
+	}
+
+	spec := strings.TrimSpace(strings.TrimPrefix(value, prefix))
+	if strings.Contains(spec, ",") {
+		return nil, nil
+	}
+
+	startStr, endStr, ok := cutString(spec, "-")
+	if !ok {
+		return nil, errRangeNotSatisfiable
+	}
+	startStr, endStr = strings.TrimSpace(startStr), strings.TrimSpace(endStr)
+
+	if startStr == "" {
+		// suffix range: last n bytes
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, errRangeNotSatisfiable
+		}
+
+		if n > size {
+			n = size
+		}
+
+		if n == 0 {
+			return nil, errRangeNotSatisfiable
+		}
+
+		return &byteRange{Start: size - n, Length: n}, nil
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return nil, errRangeNotSatisfiable
+	}
+
+	end := size - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return nil, errRangeNotSatisfiable
+		}
+
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	return &byteRange{Start: start, Length: end - start + 1}, nil
+}
+
+func cutString(s, sep string) (string, string, bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// fileETag makes strong validator from file size and modification time
+func fileETag(f File) string {
+	return fmt.Sprintf(`"%x-%x"`, f.Size, f.ModTime)
+}
+
+func etagMatch(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified evaluates If-None-Match and If-Modified-Since conditions
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatch(inm, etag)
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+
+		return !modTime.Truncate(time.Second).After(t)
+	}
+
+	return false
+}
+
+// ifRangeMatch reports whether range request should be served as partial content
+func ifRangeMatch(r *http.Request, etag string, modTime time.Time) bool {
+	ir := r.Header.Get("If-Range")
+	if ir == "" {
+		return true
+	}
+
+	if strings.HasPrefix(ir, `"`) {
+		return ir == etag
+	}
+
+	t, err := http.ParseTime(ir)
+	if err != nil {
+		return false
+	}
+
+	return modTime.Truncate(time.Second).Equal(t)
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	errInvalidFileName = errors.New("invalid file name")
+)
+
+// sanitizeFileName validates file name received from url
+// names which could escape the storage or break response headers are rejected
+func sanitizeFileName(name string) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", fmt.Errorf("%w: not utf-8", errInvalidFileName)
+	}
+
+	if strings.TrimSpace(name) == "" || name == "." || name == ".." {
+		return "", fmt.Errorf("%w: %q", errInvalidFileName, name)
+	}
+
+	for _, r := range name {
+		if r == '/' || r == '\\' || unicode.IsControl(r) || r == '\u2028' || r == '\u2029' {
+			return "", fmt.Errorf("%w: %q", errInvalidFileName, name)
+		}
+	}
+
+	return name, nil
+}
+
+// contentDisposition makes RFC 6266 header value with ascii fallback and utf-8 encoded file name
+func contentDisposition(disposition string, name string) string {
+	fallback, isASCII := asciiFileName(name)
+	if isASCII {
+		return fmt.Sprintf(`%s; filename="%s"`, disposition, fallback)
+	}
+
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, disposition, fallback, encodeRFC5987(name))
+}
+
+// asciiFileName replaces characters which are not allowed inside quoted filename parameter
+// second value reports whether original name was preserved as is
+func asciiFileName(name string) (string, bool) {
+	var b strings.Builder
+	preserved := true
+	for _, r := range name {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' || r == '/' || r == '%' {
+			b.WriteByte('_')
+			preserved = false
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String(), preserved
+}
+
+func isAttrChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
+
+// encodeRFC5987 percent-encodes all bytes except attr-char
+func encodeRFC5987(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
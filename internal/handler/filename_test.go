@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{name: "plain", input: "report.pdf"},
+		{name: "spaces and quotes", input: `my "quoted" file.txt`},
+		{name: "percent", input: "100%.txt"},
+		{name: "non ascii", input: "отчёт 2021.pdf"},
+		{name: "emoji", input: "😀.png"},
+		{name: "dots inside", input: "..hidden..txt"},
+		{name: "empty", input: "", wantErr: true},
+		{name: "blank", input: "   ", wantErr: true},
+		{name: "dot", input: ".", wantErr: true},
+		{name: "dot dot", input: "..", wantErr: true},
+		{name: "parent traversal", input: "../etc/passwd", wantErr: true},
+		{name: "windows traversal", input: `..\boot.ini`, wantErr: true},
+		{name: "absolute path", input: "/etc/passwd", wantErr: true},
+		{name: "cr lf header injection", input: "a.txt\r\nSet-Cookie: x=y", wantErr: true},
+		{name: "lf", input: "a\nb.txt", wantErr: true},
+		{name: "nul", input: "a.txt\x00.jpg", wantErr: true},
+		{name: "tab", input: "a\tb.txt", wantErr: true},
+		{name: "del", input: "a\x7fb.txt", wantErr: true},
+		{name: "line separator", input: "a\u2028b.txt", wantErr: true},
+		{name: "paragraph separator", input: "a\u2029b.txt", wantErr: true},
+		{name: "invalid utf-8", input: "a\xffb.txt", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sanitizeFileName(tt.input)
+			if tt.wantErr {
+				if !errors.Is(err, errInvalidFileName) {
+					t.Fatalf("sanitizeFileName(%q) error = %v, want errInvalidFileName", tt.input, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("sanitizeFileName(%q) unexpected error: %v", tt.input, err)
+			}
+
+			if got != tt.input {
+				t.Fatalf("sanitizeFileName(%q) = %q, want unchanged", tt.input, got)
+			}
+		})
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name        string
+		disposition string
+		input       string
+		want        string
+	}{
+		{
+			name:        "ascii",
+			disposition: "attachment",
+			input:       "report.pdf",
+			want:        `attachment; filename="report.pdf"`,
+		},
+		{
+			name:        "inline",
+			disposition: "inline",
+			input:       "image.png",
+			want:        `inline; filename="image.png"`,
+		},
+		{
+			name:        "quotes",
+			disposition: "attachment",
+			input:       `a"b.txt`,
+			want:        `attachment; filename="a_b.txt"; filename*=UTF-8''a%22b.txt`,
+		},
+		{
+			name:        "backslash",
+			disposition: "attachment",
+			input:       `a\b.txt`,
+			want:        `attachment; filename="a_b.txt"; filename*=UTF-8''a%5Cb.txt`,
+		},
+		{
+			name:        "percent",
+			disposition: "attachment",
+			input:       "100%.txt",
+			want:        `attachment; filename="100_.txt"; filename*=UTF-8''100%25.txt`,
+		},
+		{
+			name:        "spaces",
+			disposition: "attachment",
+			input:       "my file.txt",
+			want:        `attachment; filename="my file.txt"`,
+		},
+		{
+			name:        "cr lf",
+			disposition: "attachment",
+			input:       "a\r\nb.txt",
+			want:        `attachment; filename="a__b.txt"; filename*=UTF-8''a%0D%0Ab.txt`,
+		},
+		{
+			name:        "nul",
+			disposition: "attachment",
+			input:       "a\x00b.txt",
+			want:        `attachment; filename="a_b.txt"; filename*=UTF-8''a%00b.txt`,
+		},
+		{
+			name:        "cyrillic",
+			disposition: "attachment",
+			input:       "файл.txt",
+			want:        `attachment; filename="____.txt"; filename*=UTF-8''%D1%84%D0%B0%D0%B9%D0%BB.txt`,
+		},
+		{
+			name:        "euro sign",
+			disposition: "attachment",
+			input:       "€ rates.txt",
+			want:        `attachment; filename="_ rates.txt"; filename*=UTF-8''%E2%82%AC%20rates.txt`,
+		},
+		{
+			name:        "slash",
+			disposition: "attachment",
+			input:       "../x.txt",
+			want:        `attachment; filename=".._x.txt"; filename*=UTF-8''..%2Fx.txt`,
+		},
+		{
+			name:        "empty",
+			disposition: "attachment",
+			input:       "",
+			want:        `attachment; filename=""`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contentDisposition(tt.disposition, tt.input); got != tt.want {
+				t.Fatalf("contentDisposition(%q, %q) = %q, want %q", tt.disposition, tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeRFC5987(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "", want: ""},
+		{input: "abcXYZ019", want: "abcXYZ019"},
+		{input: "!#$&+-.^_`|~", want: "!#$&+-.^_`|~"},
+		{input: " ", want: "%20"},
+		{input: `"'()*,/:;<=>?@[\]{}`, want: "%22%27%28%29%2A%2C%2F%3A%3B%3C%3D%3E%3F%40%5B%5C%5D%7B%7D"},
+		{input: "%", want: "%25"},
+		{input: "\r\n\x00", want: "%0D%0A%00"},
+		{input: "ä", want: "%C3%A4"},
+		{input: "日本", want: "%E6%97%A5%E6%9C%AC"},
+	}
+
+	for _, tt := range tests {
+		if got := encodeRFC5987(tt.input); got != tt.want {
+			t.Errorf("encodeRFC5987(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -1,14 +1,20 @@
 package handler
 
 import (
+	"bufio"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Mikhalevich/filesharing/pkg/httperror"
 )
 
 // GetFileHandler get single file from storage
+// supports conditional and range requests for resumable downloads
 func (h *Handler) GetFileHandler(w http.ResponseWriter, r *http.Request) {
 	sp, err := h.requestParameters(r)
 	if err != nil {
@@ -16,18 +22,149 @@ func (h *Handler) GetFileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rsp, httpErr := h.makeGetRequest(r, w, sp.StorageName, "file", sp.Values())
+	info, httpErr := h.fileInfo(r, w, sp)
 	if httpErr != nil {
 		h.Error(httpErr, w, "GetFileHandler")
 		return
 	}
 
+	etag := fileETag(info)
+	modTime := time.Unix(info.ModTime, 0).UTC()
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	if notModified(r, etag, modTime) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var br *byteRange
+	if ifRangeMatch(r, etag, modTime) {
+		br, err = parseRange(r.Header.Get("Range"), info.Size)
+		if err != nil {
+			h.logger.WithError(err).
+				WithField("handler", "GetFileHandler").
+				Warn("invalid range")
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+			writeJSON(w, http.StatusRequestedRangeNotSatisfiable, httperror.NewInvalidParams(err.Error()))
+			return
+		}
+	}
+
+	params := h.gatewayParams(r, w, sp.StorageName, sp.Values())
+	if br != nil {
+		params.Header = http.Header{}
+		params.Header.Set("Range", br.header())
+		if ir := r.Header.Get("If-Range"); ir != "" {
+			params.Header.Set("If-Range", ir)
+		}
+	}
+
+	rsp, httpErr := h.gw.File(r.Context(), params)
+	if httpErr != nil {
+		h.Error(h.gatewayError(r, w, sp.StorageName, httpErr), w, "GetFileHandler")
+		return
+	}
+
+	if br != nil && rsp.StatusCode == http.StatusPartialContent && !gatewayServedRange(rsp, br) {
+		// partial body of another range can not be cut locally, request the whole file
+		rsp.Body.Close()
+		params.Header = nil
+		rsp, httpErr = h.gw.File(r.Context(), params)
+		if httpErr != nil {
+			h.Error(h.gatewayError(r, w, sp.StorageName, httpErr), w, "GetFileHandler")
+			return
+		}
+	}
+
 	defer rsp.Body.Close()
 
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", sp.FileName))
+	if br != nil && !gatewayServedRange(rsp, br) && rsp.StatusCode != http.StatusOK {
+		h.Error(httperror.NewInternalError(fmt.Sprintf("unexpected gateway status %d for range request", rsp.StatusCode)), w, "GetFileHandler")
+		return
+	}
+
+	reader := bufio.NewReaderSize(rsp.Body, sniffLen)
+	fromStart := br == nil || br.Start == 0 || !gatewayServedRange(rsp, br)
+	contentType := fileContentType(sp.FileName, func() []byte {
+		if !fromStart {
+			return nil
+		}
+		data, _ := reader.Peek(sniffLen)
+		return data
+	})
+
+	disposition := "attachment"
+	if r.URL.Query().Get("inline") == "1" {
+		if inlineType, ok := inlineContentType(contentType); ok {
+			disposition = "inline"
+			contentType = inlineType
+			setInlineHeaders(w, contentType)
+		}
+	}
+
+	if disposition == "attachment" {
+		contentType = attachmentContentType(contentType)
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", contentDisposition(disposition, sp.FileName))
 
-	if _, err := io.Copy(w, rsp.Body); err != nil {
-		h.Error(httperror.NewInternalError("failed to transfer bytes").WithError(err), w, "GetFileHandler")
+	if br == nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		w.WriteHeader(http.StatusOK)
+		h.copyFile(w, reader, info.Size)
 		return
 	}
+
+	body := io.Reader(reader)
+	if !gatewayServedRange(rsp, br) {
+		// gateway ignored range and sent the whole file, emulate it locally
+		if _, err := io.CopyN(ioutil.Discard, reader, br.Start); err != nil {
+			h.Error(httperror.NewInternalError("skip range start").WithError(err), w, "GetFileHandler")
+			return
+		}
+		body = io.LimitReader(reader, br.Length)
+	}
+
+	w.Header().Set("Content-Range", br.contentRange(info.Size))
+	w.Header().Set("Content-Length", strconv.FormatInt(br.Length, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	h.copyFile(w, body, br.Length)
+}
+
+func gatewayServedRange(rsp *http.Response, br *byteRange) bool {
+	if rsp.StatusCode != http.StatusPartialContent {
+		return false
+	}
+
+	return strings.HasPrefix(rsp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-%d/", br.Start, br.Start+br.Length-1))
+}
+
+// copyFile transfers file body, headers are already sent so errors are only logged
+func (h *Handler) copyFile(w io.Writer, body io.Reader, size int64) {
+	if _, err := io.CopyN(w, body, size); err != nil {
+		h.logger.WithError(err).
+			WithField("handler", "GetFileHandler").
+			Error("failed to transfer bytes")
+	}
+}
+
+// fileInfo returns size and modification time of the requested file
+func (h *Handler) fileInfo(r *http.Request, w http.ResponseWriter, sp storageParameters) (File, *httperror.Error) {
+	files, httpErr := h.listFiles(r, w, sp)
+	if httpErr != nil {
+		return File{}, httpErr
+	}
+
+	for _, f := range files {
+		if f.Name == sp.FileName {
+			return f, nil
+		}
+	}
+
+	return File{}, httperror.NewNotExistError(fmt.Sprintf("file %s not found", sp.FileName))
 }
@@ -0,0 +1,301 @@
+package handler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+const testFileContent = "0123456789"
+
+var testFile = gateway.File{Name: "a.txt", Size: int64(len(testFileContent)), ModTime: 1600000000}
+
+func fileResponse(status int, contentRange string, body string) *http.Response {
+	rsp := &http.Response{
+		StatusCode: status,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+	if contentRange != "" {
+		rsp.Header.Set("Content-Range", contentRange)
+	}
+	return rsp
+}
+
+// gateway modes for range requests
+const (
+	rangeServed  = "served"
+	rangeIgnored = "ignored"
+	rangeOther   = "other"
+)
+
+func rangeGateway(mode string) *fakeGateway {
+	return &fakeGateway{
+		list: func(p gateway.Params) ([]gateway.File, *httperror.Error) {
+			return []gateway.File{testFile}, nil
+		},
+		file: func(p gateway.Params) (*http.Response, *httperror.Error) {
+			if p.Header.Get("Range") == "" {
+				return fileResponse(http.StatusOK, "", testFileContent), nil
+			}
+
+			switch mode {
+			case rangeServed:
+				// the only range used by tests below
+				return fileResponse(http.StatusPartialContent, "bytes 3-5/10", testFileContent[3:6]), nil
+			case rangeOther:
+				return fileResponse(http.StatusPartialContent, "bytes 0-4/10", testFileContent[:5]), nil
+			}
+			return fileResponse(http.StatusOK, "", testFileContent), nil
+		},
+	}
+}
+
+func TestGetFileHandler(t *testing.T) {
+	etag := fileETag(testFile)
+
+	tests := []struct {
+		name             string
+		mode             string
+		file             string
+		header           map[string]string
+		wantStatus       int
+		wantBody         string
+		wantContentRange string
+		wantFileCalls    int
+	}{
+		{
+			name:          "whole file",
+			file:          "a.txt",
+			wantStatus:    http.StatusOK,
+			wantBody:      testFileContent,
+			wantFileCalls: 1,
+		},
+		{
+			name:             "range served by gateway",
+			mode:             rangeServed,
+			file:             "a.txt",
+			header:           map[string]string{"Range": "bytes=3-5"},
+			wantStatus:       http.StatusPartialContent,
+			wantBody:         "345",
+			wantContentRange: "bytes 3-5/10",
+			wantFileCalls:    1,
+		},
+		{
+			name:             "range ignored by gateway",
+			mode:             rangeIgnored,
+			file:             "a.txt",
+			header:           map[string]string{"Range": "bytes=3-5"},
+			wantStatus:       http.StatusPartialContent,
+			wantBody:         "345",
+			wantContentRange: "bytes 3-5/10",
+			wantFileCalls:    1,
+		},
+		{
+			name:             "other range served by gateway",
+			mode:             rangeOther,
+			file:             "a.txt",
+			header:           map[string]string{"Range": "bytes=3-5"},
+			wantStatus:       http.StatusPartialContent,
+			wantBody:         "345",
+			wantContentRange: "bytes 3-5/10",
+			wantFileCalls:    2,
+		},
+		{
+			name:             "suffix range",
+			mode:             rangeIgnored,
+			file:             "a.txt",
+			header:           map[string]string{"Range": "bytes=-2"},
+			wantStatus:       http.StatusPartialContent,
+			wantBody:         "89",
+			wantContentRange: "bytes 8-9/10",
+			wantFileCalls:    1,
+		},
+		{
+			name:          "unknown range unit",
+			file:          "a.txt",
+			header:        map[string]string{"Range": "items=3-5"},
+			wantStatus:    http.StatusOK,
+			wantBody:      testFileContent,
+			wantFileCalls: 1,
+		},
+		{
+			name:             "unsatisfiable range",
+			file:             "a.txt",
+			header:           map[string]string{"Range": "bytes=20-"},
+			wantStatus:       http.StatusRequestedRangeNotSatisfiable,
+			wantContentRange: "bytes */10",
+		},
+		{
+			name:          "stale if-range",
+			mode:          rangeServed,
+			file:          "a.txt",
+			header:        map[string]string{"Range": "bytes=3-5", "If-Range": `"stale"`},
+			wantStatus:    http.StatusOK,
+			wantBody:      testFileContent,
+			wantFileCalls: 1,
+		},
+		{
+			name:       "not modified",
+			file:       "a.txt",
+			header:     map[string]string{"If-None-Match": etag},
+			wantStatus: http.StatusNotModified,
+		},
+		{
+			name:       "not found",
+			file:       "missing.txt",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := rangeGateway(tt.mode)
+			session := newFakeSession()
+			session.tokens["s1"] = &Token{Value: "token"}
+			h := New(gw, session, nopLogger{})
+
+			r := httptest.NewRequest(http.MethodGet, "/s1/"+tt.file+"/", nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+
+			w := httptest.NewRecorder()
+			h.GetFileHandler(w, withRouterParameters(r, "s1", false, tt.file))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+
+			if cr := w.Header().Get("Content-Range"); cr != tt.wantContentRange {
+				t.Errorf("content range = %q, want %q", cr, tt.wantContentRange)
+			}
+
+			if n := gw.called("file"); n != tt.wantFileCalls {
+				t.Errorf("gateway file calls = %d, want %d", n, tt.wantFileCalls)
+			}
+
+			if gw.called("list") != 1 {
+				t.Errorf("file list should be requested once for size and modification time")
+			}
+
+			if tt.wantStatus == http.StatusOK || tt.wantStatus == http.StatusPartialContent {
+				if got := w.Header().Get("ETag"); got != etag {
+					t.Errorf("etag = %q, want %q", got, etag)
+				}
+				if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="a.txt"` {
+					t.Errorf("content disposition = %q", got)
+				}
+				if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+					t.Errorf("x-content-type-options = %q", got)
+				}
+			}
+		})
+	}
+}
+
+func TestGetFileHandlerRefetchesWholeFile(t *testing.T) {
+	gw := rangeGateway(rangeOther)
+	h := New(gw, newFakeSession(), nopLogger{})
+
+	r := httptest.NewRequest(http.MethodGet, "/s1/a.txt/", nil)
+	r.Header.Set("Range", "bytes=3-5")
+	h.GetFileHandler(httptest.NewRecorder(), withRouterParameters(r, "s1", false, "a.txt"))
+
+	var ranges []string
+	for i, c := range gw.calls {
+		if c == "file" {
+			ranges = append(ranges, gw.params[i].Header.Get("Range"))
+		}
+	}
+
+	if len(ranges) != 2 || ranges[0] != "bytes=3-5" || ranges[1] != "" {
+		t.Fatalf("gateway ranges = %q, want range request followed by whole file", ranges)
+	}
+}
+
+// TestGetFileHandlerRoundTrip resumes download with validators of the first response
+// through real gateway client and http server
+func TestGetFileHandlerRoundTrip(t *testing.T) {
+	gwSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/list/":
+			json.NewEncoder(w).Encode([]gateway.File{testFile})
+		case "/file/":
+			http.ServeContent(w, r, testFile.Name, time.Unix(testFile.ModTime, 0), strings.NewReader(testFileContent))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer gwSrv.Close()
+
+	session := newFakeSession()
+	session.tokens["s1"] = &Token{Value: "token"}
+	h := New(gateway.New(gwSrv.URL), session, nopLogger{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.GetFileHandler(w, withRouterParameters(r, "s1", false, testFile.Name))
+	}))
+	defer srv.Close()
+
+	get := func(header map[string]string) (*http.Response, string) {
+		t.Helper()
+
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/s1/a.txt/", nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+
+		rsp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		defer rsp.Body.Close()
+
+		body, err := ioutil.ReadAll(rsp.Body)
+		if err != nil {
+			t.Fatalf("read body: %v", err)
+		}
+		return rsp, string(body)
+	}
+
+	rsp, body := get(nil)
+	if rsp.StatusCode != http.StatusOK || body != testFileContent {
+		t.Fatalf("first download: status = %d, body = %q", rsp.StatusCode, body)
+	}
+
+	etag, lastModified := rsp.Header.Get("ETag"), rsp.Header.Get("Last-Modified")
+	if etag == "" || lastModified == "" {
+		t.Fatalf("validators are missing: etag = %q, last modified = %q", etag, lastModified)
+	}
+
+	if rsp, _ := get(map[string]string{"If-None-Match": etag}); rsp.StatusCode != http.StatusNotModified {
+		t.Errorf("if-none-match status = %d, want %d", rsp.StatusCode, http.StatusNotModified)
+	}
+
+	if rsp, _ := get(map[string]string{"If-Modified-Since": lastModified}); rsp.StatusCode != http.StatusNotModified {
+		t.Errorf("if-modified-since status = %d, want %d", rsp.StatusCode, http.StatusNotModified)
+	}
+
+	for _, ifRange := range []string{etag, lastModified} {
+		rsp, body := get(map[string]string{"Range": "bytes=4-", "If-Range": ifRange})
+		if rsp.StatusCode != http.StatusPartialContent || body != testFileContent[4:] {
+			t.Errorf("resume with if-range %s: status = %d, body = %q", ifRange, rsp.StatusCode, body)
+		}
+
+		if cr := rsp.Header.Get("Content-Range"); cr != "bytes 4-9/10" {
+			t.Errorf("content range = %q, want bytes 4-9/10", cr)
+		}
+	}
+}
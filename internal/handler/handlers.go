@@ -1,16 +1,18 @@
 package handler
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
 	"github.com/Mikhalevich/filesharing/pkg/ctxinfo"
 	"github.com/Mikhalevich/filesharing/pkg/httperror"
 	"github.com/Mikhalevich/filesharing/pkg/service"
@@ -29,14 +31,13 @@ var (
 	ErrExpired             = errors.New("session is expired")
 	ErrNotAuthorized       = errors.New("not authorized")
 	ErrInternalServerError = errors.New("intrnal server error")
+
+	// errUploadAborted stops multipart producer once the gateway finished the upload request
+	errUploadAborted = errors.New("upload is aborted")
 )
 
 // File represents one file from storage
-type File struct {
-	Name    string
-	Size    int64
-	ModTime int64
-}
+type File = gateway.File
 
 type User struct {
 	Name string
@@ -45,12 +46,37 @@ type User struct {
 
 type Token struct {
 	Value string
+	// SignIn starts a new session lifetime instead of continuing the current one
+	SignIn bool
+	// Remember requests long lived session, it is taken into account on sign in only
+	Remember bool
 }
 
 type Sessioner interface {
 	GetToken(name string, r *http.Request) *Token
-	SetToken(w http.ResponseWriter, token *Token, name string)
-	Remove(w http.ResponseWriter, name string)
+	// SetToken fails when the token is not stored, sign in must not succeed then
+	SetToken(w http.ResponseWriter, r *http.Request, token *Token, name string) error
+	// Touch extends session on activity within the session max lifetime
+	Touch(w http.ResponseWriter, r *http.Request, name string)
+	Remove(w http.ResponseWriter, r *http.Request, name string)
+	Storages(r *http.Request) []string
+}
+
+// GatewayClient represents calls to the filesharing gateway
+type GatewayClient interface {
+	List(ctx context.Context, p gateway.Params) ([]gateway.File, *httperror.Error)
+	File(ctx context.Context, p gateway.Params) (*http.Response, *httperror.Error)
+	IndexHTML(ctx context.Context, p gateway.Params) (*http.Response, *httperror.Error)
+	Upload(ctx context.Context, p gateway.Params, body io.Reader, contentType string) *httperror.Error
+	Remove(ctx context.Context, p gateway.Params) *httperror.Error
+	ShareText(ctx context.Context, p gateway.Params) *httperror.Error
+	Login(ctx context.Context, p gateway.Params) (string, *httperror.Error)
+	Register(ctx context.Context, p gateway.Params) (string, *httperror.Error)
+	Refresh(ctx context.Context, p gateway.Params) (string, *httperror.Error)
+	ChangePassword(ctx context.Context, p gateway.Params) *httperror.Error
+	DeleteStorage(ctx context.Context, p gateway.Params) *httperror.Error
+	ExchangeToken(ctx context.Context, p gateway.Params) (string, *httperror.Error)
+	IssueToken(ctx context.Context, p gateway.Params) (string, *httperror.Error)
 }
 
 type Logger interface {
@@ -68,25 +94,94 @@ type Logger interface {
 
 // Handler represents gateway handler
 type Handler struct {
-	gwh     string
-	session Sessioner
-	logger  Logger
+	gw             GatewayClient
+	session        Sessioner
+	logger         Logger
+	publicStorages map[string]bool
+	listCache      *listCache
+	adminToken     string
+	refreshBefore  time.Duration
+	loginLimiter   *loginLimiter
+	trustedProxies []*net.IPNet
+	passwordPolicy PasswordPolicy
+	oidc           *OIDC
+	apiTokens      APITokenStore
+	shareLinks     *ShareLinks
+	csrfSecure     bool
+}
+
+// Option configures optional Handler parameters
+type Option func(h *Handler)
+
+// WithPublicStorages sets storages which are accessible without session token
+func WithPublicStorages(names []string) Option {
+	return func(h *Handler) {
+		for _, name := range names {
+			h.publicStorages[name] = true
+		}
+	}
+}
+
+// WithListCacheTTL sets how long file lists are kept for read only browsing while gateway is down
+func WithListCacheTTL(ttl time.Duration) Option {
+	return func(h *Handler) {
+		h.listCache = newListCache(ttl)
+	}
 }
 
 // New constructor for Handler
-func New(gatewayHost string, ses Sessioner, l Logger) *Handler {
-	return &Handler{
-		gwh:     gatewayHost,
-		session: ses,
-		logger:  l,
+func New(gw GatewayClient, ses Sessioner, l Logger, opts ...Option) *Handler {
+	h := &Handler{
+		gw:             gw,
+		session:        ses,
+		logger:         l,
+		publicStorages: make(map[string]bool),
+		listCache:      newListCache(0),
+		passwordPolicy: PasswordPolicy{MinLength: 8, MinClasses: 2},
+	}
+
+	for _, opt := range opts {
+		opt(h)
 	}
+
+	return h
+}
+
+// RedirectError indicates that browser should be redirected to the URL instead of getting json error
+type RedirectError struct {
+	URL string
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("redirect to %s", e.URL)
 }
 
 func (h *Handler) Error(err *httperror.Error, w http.ResponseWriter, handler string) {
+	var redirectErr *RedirectError
+	if errors.As(err, &redirectErr) {
+		h.logger.WithError(err).
+			WithField("handler", handler).
+			Info("redirect")
+		w.Header().Set("Location", redirectErr.URL)
+		w.WriteHeader(http.StatusFound)
+		return
+	}
+
+	status := errorStatus(err)
 	h.logger.WithError(err).
 		WithField("handler", handler).
+		WithField("status", status).
 		Error("handler error")
-	err.WriteJSON(w)
+
+	setRetryAfter(w, err)
+
+	var unavailableErr *UnavailableError
+	if errors.As(err, &unavailableErr) {
+		h.renderUnavailable(w, err)
+		return
+	}
+
+	writeJSON(w, status, err)
 }
 
 type storageParameters struct {
@@ -139,6 +234,8 @@ func (h *Handler) requestParameters(r *http.Request) (storageParameters, error)
 		fileName = ""
 	} else if err != nil {
 		return storageParameters{}, fmt.Errorf("unable to get file name: %w", err)
+	} else if fileName, err = sanitizeFileName(fileName); err != nil {
+		return storageParameters{}, err
 	}
 
 	return storageParameters{
@@ -162,91 +259,231 @@ func (h *Handler) RecoverMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func (h *Handler) makeURL(endpoint string) string {
-	return fmt.Sprintf("%s/%s/", h.gwh, endpoint)
+// CheckAuthMiddleware verifies that session token for requested storage exists
+// browser requests are redirected to the login page, api requests get unauthorized error
+func (h *Handler) CheckAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sp, err := h.requestParameters(r)
+		if err != nil {
+			h.Error(httperror.NewInvalidParams("request parametes").WithError(err), w, "CheckAuthMiddleware")
+			return
+		}
+
+		if sp.IsPublic || h.publicStorages[sp.StorageName] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// expired cookies are not sent by the browser so missing token covers expired session as well
+		token := h.sessionToken(r, sp.StorageName)
+		if token == "" {
+			if isAPIRequest(r) {
+				h.Error(httperror.NewUnauthorized("session token is missing or expired"), w, "CheckAuthMiddleware")
+				return
+			}
+
+			http.Redirect(w, r, loginURL(sp.StorageName, r), http.StatusFound)
+			return
+		}
+
+		if bearerToken(r) == "" {
+			h.session.Touch(w, r, sp.StorageName)
+			h.refreshToken(r, w, sp.StorageName, token)
+		}
+
+		next.ServeHTTP(w, r)
+	})
 }
 
-func (h *Handler) sessionToken(r *http.Request, storageName string) string {
-	if token := h.session.GetToken(storageName, r); token != nil {
-		return token.Value
-	}
-	return ""
+// SessionOnlyMiddleware rejects requests authorized by bearer token
+// bearer token is verified by the gateway only when the handler forwards it,
+// routes acting on the local state alone must be authorized by the session
+func (h *Handler) SessionOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if bearerToken(r) != "" {
+			h.Error(httperror.NewUnauthorized("bearer token is not accepted, please sign in"), w, "SessionOnlyMiddleware")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
 }
 
-func (h *Handler) processRequest(req *http.Request, storageName string, w http.ResponseWriter) (*http.Response, *httperror.Error) {
-	rsp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, httperror.NewInternalError("do request").WithError(err)
+// isAPIRequest reports whether request was made by script(ajax, dropzone, rest api) rather than browser navigation
+func isAPIRequest(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/api/") || bearerToken(r) != "" {
+		return true
 	}
 
-	if rsp.StatusCode != http.StatusOK {
-		if rsp.StatusCode == http.StatusBadRequest {
-			var httpErr httperror.Error
-			if err := json.NewDecoder(rsp.Body).Decode(&httpErr); err != nil {
-				return nil, httperror.NewInternalError("json decode").WithError(err)
-			}
+	if r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
+		return true
+	}
 
-			// if httpErr.Code == httperror.CodeUnauthorized {
-			// 	return nil, httpcode.NewHTTPRedirectFoundError(fmt.Sprintf("/login/%s", storageName), err.Error())
-			// }
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
 
-			return nil, &httpErr
-		}
+// loginURL makes login page url which returns back to the origin request after sign in
+func loginURL(storageName string, r *http.Request) string {
+	return fmt.Sprintf("/login/%s/?%s", storageName, url.Values{"next": []string{r.URL.RequestURI()}}.Encode())
+}
 
-		return nil, httperror.NewInternalError("invalid status code")
+// bearerToken returns token from Authorization header if any
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return ""
 	}
 
-	if token := rsp.Header.Get("X-Token"); token != "" {
-		h.session.SetToken(w, &Token{Value: string(token)}, storageName)
-	}
+	return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+}
 
-	return rsp, nil
+type gatewayTokenContextKey struct{}
+
+// withGatewayToken authorizes gateway calls of the request by the token instead of session one
+func withGatewayToken(r *http.Request, token string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), gatewayTokenContextKey{}, token))
 }
 
-func (h *Handler) makeGetRequest(originReq *http.Request, w http.ResponseWriter, storageName string, endpoint string, values url.Values) (*http.Response, *httperror.Error) {
-	req, err := http.NewRequest(http.MethodGet, h.makeURL(endpoint), nil)
-	if err != nil {
-		return nil, httperror.NewInternalError("make get request").WithError(err)
+func requestGatewayToken(r *http.Request) (string, bool) {
+	token, ok := r.Context().Value(gatewayTokenContextKey{}).(string)
+	return token, ok
+}
+
+func (h *Handler) sessionToken(r *http.Request, storageName string) string {
+	if token, ok := requestGatewayToken(r); ok {
+		return token
 	}
 
-	req.URL.RawQuery = values.Encode()
+	if apiToken, ok := requestAPIToken(r); ok {
+		return apiToken.GatewayToken
+	}
 
-	if token := h.sessionToken(originReq, storageName); token != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	// bearer token is not verified here, it is passed to the gateway which rejects invalid ones
+	// so the handlers which do not call the gateway are registered as session only
+	if token := bearerToken(r); token != "" {
+		// personal api token is accepted by scoped routes only
+		if strings.HasPrefix(token, APITokenPrefix) {
+			return ""
+		}
+		return token
 	}
 
-	return h.processRequest(req, storageName, w)
+	if token := h.session.GetToken(storageName, r); token != nil {
+		return token.Value
+	}
+	return ""
 }
 
-func (h *Handler) makePostRequest(originReq *http.Request, w http.ResponseWriter, storageName string, endpoint string, values url.Values) (*http.Response, *httperror.Error) {
-	req, err := http.NewRequest(http.MethodPost, h.makeURL(endpoint), strings.NewReader(values.Encode()))
-	if err != nil {
-		return nil, httperror.NewInternalError("make post request").WithError(err)
+// gatewayParams makes parameters for the gateway call on behalf of the origin request
+// tokens issued by gateway are stored in the session or returned in header for bearer requests
+func (h *Handler) gatewayParams(r *http.Request, w http.ResponseWriter, storageName string, values url.Values) gateway.Params {
+	return gateway.Params{
+		Token:  h.sessionToken(r, storageName),
+		Values: values,
+		OnToken: func(token string) {
+			if _, ok := requestGatewayToken(r); ok {
+				return
+			}
+
+			if apiToken, ok := requestAPIToken(r); ok {
+				h.updateGatewayToken(apiToken, token)
+				return
+			}
+
+			if bearerToken(r) != "" {
+				w.Header().Set("X-Token", token)
+				return
+			}
+			if err := h.session.SetToken(w, r, &Token{Value: token}, storageName); err != nil {
+				h.logger.WithError(err).
+					WithField("storage", storageName).
+					Warn("unable to store gateway token")
+			}
+		},
+	}
+}
+
+// gatewayError converts unauthorized gateway error into the login redirect for browser requests
+// and drops stale session token
+func (h *Handler) gatewayError(r *http.Request, w http.ResponseWriter, storageName string, err *httperror.Error) *httperror.Error {
+	if isGatewayUnavailable(err) && !isAPIRequest(r) {
+		return httperror.NewInternalError(err.Description).WithError(&UnavailableError{cause: err})
+	}
+
+	if err.Code != httperror.CodeUnauthorized || storageName == "" || bearerToken(r) != "" {
+		return err
 	}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	if token := h.sessionToken(originReq, storageName); token != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	if _, ok := requestGatewayToken(r); ok {
+		return err
 	}
 
-	return h.processRequest(req, storageName, w)
+	h.session.Remove(w, r, storageName)
+
+	if isAPIRequest(r) {
+		return err
+	}
+
+	return httperror.NewUnauthorized(err.Description).WithError(&RedirectError{URL: loginURL(storageName, r)})
 }
 
-func (h *Handler) multipartBody(originReq *http.Request) (*bytes.Buffer, string, error) {
+// multipartBody streams file parts of the origin request through a pipe so the upload never has to fit in memory.
+// The copy result is sent to the returned channel once the pipe writer is closed.
+func (h *Handler) multipartBody(originReq *http.Request) (*io.PipeReader, string, <-chan error, error) {
 	mr, err := originReq.MultipartReader()
 	if err != nil {
-		return nil, "", fmt.Errorf("multipart reader: %w", err)
+		return nil, "", nil, fmt.Errorf("multipart reader: %w", err)
 	}
 
-	body := &bytes.Buffer{}
-	mw := multipart.NewWriter(body)
+	body, contentType, errCh := pipeMultipart(func(mw *multipart.Writer) error {
+		return copyParts(mr, mw)
+	})
+
+	return body, contentType, errCh, nil
+}
+
+// fileBody streams raw data as single file part
+func fileBody(fileName string, data io.Reader) (*io.PipeReader, string, <-chan error) {
+	return pipeMultipart(func(mw *multipart.Writer) error {
+		filePart, err := mw.CreateFormFile(fileName, fileName)
+		if err != nil {
+			return fmt.Errorf("create form file: %w", err)
+		}
+
+		if _, err = io.Copy(filePart, data); err != nil {
+			return fmt.Errorf("copy data: %w", err)
+		}
+
+		if err := mw.Close(); err != nil {
+			return fmt.Errorf("close: %w", err)
+		}
 
+		return nil
+	})
+}
+
+func pipeMultipart(write func(mw *multipart.Writer) error) (*io.PipeReader, string, <-chan error) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	errCh := make(chan error, 1)
+
+	go func() {
+		err := write(mw)
+		pw.CloseWithError(err)
+		errCh <- err
+	}()
+
+	return pr, mw.FormDataContentType(), errCh
+}
+
+func copyParts(mr *multipart.Reader, mw *multipart.Writer) error {
 	for {
 		part, err := mr.NextPart()
 		if errors.Is(err, io.EOF) {
 			break
 		} else if err != nil {
-			return nil, "", fmt.Errorf("next part: %w", err)
+			return fmt.Errorf("next part: %w", err)
 		}
 
 		fileName := part.FileName()
@@ -256,36 +493,48 @@ func (h *Handler) multipartBody(originReq *http.Request) (*bytes.Buffer, string,
 
 		filePart, err := mw.CreateFormFile(fileName, fileName)
 		if err != nil {
-			return nil, "", fmt.Errorf("create form file: %w", err)
+			return fmt.Errorf("create form file: %w", err)
 		}
 
 		if _, err = io.Copy(filePart, part); err != nil {
-			return nil, "", fmt.Errorf("copy data: %w", err)
+			return fmt.Errorf("copy data: %w", err)
 		}
 	}
 
-	if err = mw.Close(); err != nil {
-		return nil, "", fmt.Errorf("close: %w", err)
+	if err := mw.Close(); err != nil {
+		return fmt.Errorf("close: %w", err)
 	}
 
-	return body, mw.FormDataContentType(), nil
+	return nil
 }
 
-func (h *Handler) makeMultipartRequest(originReq *http.Request, w http.ResponseWriter, storageName string, endpoint string) (*http.Response, *httperror.Error) {
-	body, contentType, err := h.multipartBody(originReq)
-	if err != nil {
-		return nil, httperror.NewInternalError("make body").WithError(err)
-	}
+// uploadStream sends streamed multipart body to the gateway
+// producer errors take precedence over gateway ones because they are the root cause
+func (h *Handler) uploadStream(r *http.Request, w http.ResponseWriter, sp storageParameters, body *io.PipeReader, contentType string, errCh <-chan error) *httperror.Error {
+	httpErr := h.gw.Upload(r.Context(), h.gatewayParams(r, w, sp.StorageName, sp.Values()), body, contentType)
+
+	// unblock producer if gateway stopped reading before the end of the body,
+	// producer waiting for the stalled client is abandoned once the request is canceled
+	body.CloseWithError(errUploadAborted)
+	select {
+	case streamErr := <-errCh:
+		if streamErr != nil && !errors.Is(streamErr, errUploadAborted) {
+			if ctxErr := r.Context().Err(); ctxErr != nil {
+				return httperror.NewInternalError("upload canceled").WithError(ctxErr)
+			}
 
-	req, err := http.NewRequest(http.MethodPost, h.makeURL(endpoint), body)
-	if err != nil {
-		return nil, httperror.NewInternalError("make post request").WithError(err)
+			return httperror.NewInvalidParams("read multipart body").WithError(streamErr)
+		}
+	case <-r.Context().Done():
+		return httperror.NewInternalError("upload canceled").WithError(r.Context().Err())
 	}
 
-	req.Header.Set("Content-Type", contentType)
-	if token := h.sessionToken(originReq, storageName); token != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	if httpErr != nil {
+		if ctxErr := r.Context().Err(); ctxErr != nil {
+			return httperror.NewInternalError("upload canceled").WithError(ctxErr)
+		}
+		return h.gatewayError(r, w, sp.StorageName, httpErr)
 	}
 
-	return h.processRequest(req, storageName, w)
+	return nil
 }
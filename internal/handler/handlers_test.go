@@ -0,0 +1,315 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing/pkg/ctxinfo"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+	"github.com/Mikhalevich/filesharing/pkg/service"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...interface{})            {}
+func (nopLogger) Infof(format string, args ...interface{})             {}
+func (nopLogger) Warnf(format string, args ...interface{})             {}
+func (nopLogger) Errorf(format string, args ...interface{})            {}
+func (nopLogger) Debug(args ...interface{})                            {}
+func (nopLogger) Info(args ...interface{})                             {}
+func (nopLogger) Warn(args ...interface{})                             {}
+func (nopLogger) Error(args ...interface{})                            {}
+func (l nopLogger) WithContext(ctx context.Context) service.Logger     { return l }
+func (l nopLogger) WithError(err error) service.Logger                 { return l }
+func (l nopLogger) WithField(key string, v interface{}) service.Logger { return l }
+func (l nopLogger) WithFields(map[string]interface{}) service.Logger   { return l }
+
+// fakeGateway records calls and delegates them to the configured functions
+// calls without function fail with internal error
+type fakeGateway struct {
+	mu     sync.Mutex
+	calls  []string
+	params []gateway.Params
+
+	list    func(p gateway.Params) ([]gateway.File, *httperror.Error)
+	file    func(p gateway.Params) (*http.Response, *httperror.Error)
+	upload  func(p gateway.Params, body io.Reader, contentType string) *httperror.Error
+	remove  func(p gateway.Params) *httperror.Error
+	login   func(p gateway.Params) (string, *httperror.Error)
+	tokenFn func(endpoint string, p gateway.Params) (string, *httperror.Error)
+	// storageFn serves changePassword and deleteStorage calls
+	storageFn func(endpoint string, p gateway.Params) *httperror.Error
+}
+
+func (g *fakeGateway) record(endpoint string, p gateway.Params) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.calls = append(g.calls, endpoint)
+	g.params = append(g.params, p)
+}
+
+func (g *fakeGateway) called(endpoint string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	n := 0
+	for _, c := range g.calls {
+		if c == endpoint {
+			n++
+		}
+	}
+	return n
+}
+
+func notImplemented(endpoint string) *httperror.Error {
+	return httperror.NewInternalError("fake gateway: " + endpoint + " is not implemented")
+}
+
+func (g *fakeGateway) List(ctx context.Context, p gateway.Params) ([]gateway.File, *httperror.Error) {
+	g.record("list", p)
+	if g.list == nil {
+		return nil, notImplemented("list")
+	}
+	return g.list(p)
+}
+
+func (g *fakeGateway) File(ctx context.Context, p gateway.Params) (*http.Response, *httperror.Error) {
+	g.record("file", p)
+	if g.file == nil {
+		return nil, notImplemented("file")
+	}
+	return g.file(p)
+}
+
+func (g *fakeGateway) IndexHTML(ctx context.Context, p gateway.Params) (*http.Response, *httperror.Error) {
+	g.record("index.html", p)
+	return nil, notImplemented("index.html")
+}
+
+func (g *fakeGateway) Upload(ctx context.Context, p gateway.Params, body io.Reader, contentType string) *httperror.Error {
+	g.record("upload", p)
+	if g.upload == nil {
+		return notImplemented("upload")
+	}
+	return g.upload(p, body, contentType)
+}
+
+func (g *fakeGateway) Remove(ctx context.Context, p gateway.Params) *httperror.Error {
+	g.record("remove", p)
+	if g.remove == nil {
+		return notImplemented("remove")
+	}
+	return g.remove(p)
+}
+
+func (g *fakeGateway) ShareText(ctx context.Context, p gateway.Params) *httperror.Error {
+	g.record("shareText", p)
+	return notImplemented("shareText")
+}
+
+func (g *fakeGateway) Login(ctx context.Context, p gateway.Params) (string, *httperror.Error) {
+	g.record("login", p)
+	if g.login == nil {
+		return "", notImplemented("login")
+	}
+	return g.login(p)
+}
+
+func (g *fakeGateway) token(endpoint string, p gateway.Params) (string, *httperror.Error) {
+	g.record(endpoint, p)
+	if g.tokenFn == nil {
+		return "", notImplemented(endpoint)
+	}
+	return g.tokenFn(endpoint, p)
+}
+
+func (g *fakeGateway) Register(ctx context.Context, p gateway.Params) (string, *httperror.Error) {
+	return g.token("register", p)
+}
+
+func (g *fakeGateway) Refresh(ctx context.Context, p gateway.Params) (string, *httperror.Error) {
+	return g.token("refresh", p)
+}
+
+func (g *fakeGateway) ExchangeToken(ctx context.Context, p gateway.Params) (string, *httperror.Error) {
+	return g.token("exchangeToken", p)
+}
+
+func (g *fakeGateway) IssueToken(ctx context.Context, p gateway.Params) (string, *httperror.Error) {
+	return g.token("issueToken", p)
+}
+
+func (g *fakeGateway) storage(endpoint string, p gateway.Params) *httperror.Error {
+	g.record(endpoint, p)
+	if g.storageFn == nil {
+		return notImplemented(endpoint)
+	}
+	return g.storageFn(endpoint, p)
+}
+
+func (g *fakeGateway) ChangePassword(ctx context.Context, p gateway.Params) *httperror.Error {
+	return g.storage("changePassword", p)
+}
+
+func (g *fakeGateway) DeleteStorage(ctx context.Context, p gateway.Params) *httperror.Error {
+	return g.storage("deleteStorage", p)
+}
+
+// fakeSession keeps tokens by storage name in memory
+type fakeSession struct {
+	tokens map[string]*Token
+	setErr error
+}
+
+func newFakeSession() *fakeSession {
+	return &fakeSession{tokens: make(map[string]*Token)}
+}
+
+func (s *fakeSession) GetToken(name string, r *http.Request) *Token {
+	return s.tokens[name]
+}
+
+func (s *fakeSession) SetToken(w http.ResponseWriter, r *http.Request, token *Token, name string) error {
+	if s.setErr != nil {
+		return s.setErr
+	}
+	s.tokens[name] = token
+	return nil
+}
+
+func (s *fakeSession) Touch(w http.ResponseWriter, r *http.Request, name string) {}
+
+func (s *fakeSession) Remove(w http.ResponseWriter, r *http.Request, name string) {
+	delete(s.tokens, name)
+}
+
+func (s *fakeSession) Storages(r *http.Request) []string {
+	names := make([]string, 0, len(s.tokens))
+	for name := range s.tokens {
+		names = append(names, name)
+	}
+	return names
+}
+
+// withRouterParameters stores parameters which router extracts from the url
+func withRouterParameters(r *http.Request, storage string, isPermanent bool, fileName string) *http.Request {
+	ctx := ctxinfo.WithPublicStorage(r.Context(), false)
+	ctx = ctxinfo.WithUserName(ctx, storage)
+	ctx = ctxinfo.WithPermanentStorage(ctx, isPermanent)
+	if fileName != "" {
+		ctx = ctxinfo.WithFileName(ctx, fileName)
+	}
+	return r.WithContext(ctx)
+}
+
+func TestCheckAuthMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		header       http.Header
+		token        string
+		public       bool
+		wantStatus   int
+		wantLocation string
+		wantNext     bool
+	}{
+		{
+			name:         "browser without session",
+			path:         "/s1/a.txt/",
+			wantStatus:   http.StatusFound,
+			wantLocation: "/login/s1/?next=%2Fs1%2Fa.txt%2F",
+		},
+		{
+			name:       "ajax without session",
+			path:       "/s1/",
+			header:     http.Header{"X-Requested-With": {"XMLHttpRequest"}},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "json client without session",
+			path:       "/s1/",
+			header:     http.Header{"Accept": {"application/json"}},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "api path without session",
+			path:       "/api/v1/storages/s1/files/",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "signed in",
+			path:       "/s1/",
+			token:      "token",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		{
+			name:       "bearer token",
+			path:       "/api/v1/storages/s1/files/",
+			header:     http.Header{"Authorization": {"Bearer token"}},
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		{
+			name:       "public storage",
+			path:       "/s1/",
+			public:     true,
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newFakeSession()
+			if tt.token != "" {
+				session.tokens["s1"] = &Token{Value: tt.token}
+			}
+
+			var opts []Option
+			if tt.public {
+				opts = append(opts, WithPublicStorages([]string{"s1"}))
+			}
+			h := New(&fakeGateway{}, session, nopLogger{}, opts...)
+
+			nextCalled := false
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				nextCalled = true
+			})
+
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for name, values := range tt.header {
+				r.Header[name] = values
+			}
+
+			w := httptest.NewRecorder()
+			h.CheckAuthMiddleware(next).ServeHTTP(w, withRouterParameters(r, "s1", false, ""))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if loc := w.Header().Get("Location"); loc != tt.wantLocation {
+				t.Errorf("location = %q, want %q", loc, tt.wantLocation)
+			}
+
+			if nextCalled != tt.wantNext {
+				t.Errorf("next called = %v, want %v", nextCalled, tt.wantNext)
+			}
+
+			if tt.wantStatus == http.StatusUnauthorized {
+				var rsp struct {
+					Code httperror.Code `json:"code"`
+				}
+				if err := json.NewDecoder(w.Body).Decode(&rsp); err != nil || rsp.Code != httperror.CodeUnauthorized {
+					t.Errorf("error body code = %v (%v), want %v", rsp.Code, err, httperror.CodeUnauthorized)
+				}
+			}
+		})
+	}
+}
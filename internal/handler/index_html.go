@@ -15,9 +15,9 @@ func (h *Handler) IndexHTMLHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rsp, httpErr := h.makeGetRequest(r, w, sp.StorageName, "index.html", sp.Values())
+	rsp, httpErr := h.gw.IndexHTML(r.Context(), h.gatewayParams(r, w, sp.StorageName, sp.Values()))
 	if httpErr != nil {
-		h.Error(httpErr, w, "IndexHTMLHandler")
+		h.Error(h.gatewayError(r, w, sp.StorageName, httpErr), w, "IndexHTMLHandler")
 		return
 	}
 
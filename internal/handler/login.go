@@ -2,8 +2,8 @@ package handler
 
 import (
 	"fmt"
-	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"github.com/Mikhalevich/filesharing-web-service/internal/template"
 	"github.com/Mikhalevich/filesharing/pkg/httperror"
@@ -12,26 +12,33 @@ import (
 // LoginHandler sign in for the existing storage(user)
 func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	userInfo := template.NewTemplatePassword()
+	userInfo.CSRFToken = csrfToken(r)
 	renderTemplate := true
+	status := http.StatusOK
 	defer func() {
 		if renderTemplate {
+			w.WriteHeader(status)
 			if err := userInfo.Execute(w); err != nil {
 				h.logger.Error(err)
 			}
 		}
 	}()
 
-	if r.Method != http.MethodPost {
-		return
-	}
-
 	sp, err := h.requestParameters(r)
 	if err != nil {
+		renderTemplate = false
 		h.Error(httperror.NewInvalidParams("request parametes").WithError(err), w, "LoginHandler")
 		return
 	}
 
+	userInfo.SSOURL = h.oidcLoginURL(sp.StorageName, r.FormValue("next"))
+
+	if r.Method != http.MethodPost {
+		return
+	}
+
 	userInfo.Password = r.FormValue("password")
+	userInfo.Remember = r.FormValue("remember") == "true"
 
 	if sp.StorageName == "" {
 		userInfo.AddError("name", "Please specify storage name to login")
@@ -45,32 +52,53 @@ func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ip := h.clientIP(r)
+	if httpErr := h.loginLimiter.Allow(ip, sp.StorageName); httpErr != nil {
+		status = http.StatusTooManyRequests
+		setRetryAfter(w, httpErr)
+		userInfo.AddError("common", "Too many login attempts, please try again in %d seconds", retryAfterSeconds(httpErr))
+		return
+	}
+
 	values := sp.Values()
 	values.Add("password", userInfo.Password)
 
-	rsp, httpErr := h.makePostRequest(r, w, sp.StorageName, "login", values)
+	token, httpErr := h.gw.Login(r.Context(), h.gatewayParams(r, w, sp.StorageName, values))
 	if httpErr != nil {
 		switch httpErr.Code {
 		case httperror.CodeNotExist:
+			h.loginLimiter.Failure(ip, sp.StorageName)
 			userInfo.AddError("common", "Invalid storage name or password")
 		case httperror.CodeNotMatch:
+			h.loginLimiter.Failure(ip, sp.StorageName)
 			userInfo.AddError("common", "Invalid storage name or password")
 		default:
-			userInfo.AddError("common", httpErr.Description)
+			userInfo.AddError("common", "%s", httpErr.Description)
 		}
 		return
 	}
 
-	defer rsp.Body.Close()
+	h.loginLimiter.Success(ip, sp.StorageName)
 
-	token, err := ioutil.ReadAll(rsp.Body)
-	if err != nil {
-		h.Error(httperror.NewInternalError("invalid session token").WithError(err), w, "LoginHandler")
+	if err := h.session.SetToken(w, r, &Token{Value: token, SignIn: true, Remember: userInfo.Remember}, sp.StorageName); err != nil {
+		h.logger.WithError(err).
+			WithField("storage", sp.StorageName).
+			Error("unable to store session")
+		status = http.StatusInternalServerError
+		userInfo.AddError("common", "Unable to sign in, please try again")
 		return
 	}
 
-	h.session.SetToken(w, &Token{Value: string(token)}, sp.StorageName)
-
 	renderTemplate = false
-	http.Redirect(w, r, fmt.Sprintf("/%s", sp.StorageName), http.StatusFound)
+	http.Redirect(w, r, nextURL(r, fmt.Sprintf("/%s", sp.StorageName)), http.StatusFound)
+}
+
+// nextURL returns local return url from next parameter or default one
+func nextURL(r *http.Request, defaultURL string) string {
+	next := r.FormValue("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return defaultURL
+	}
+
+	return next
 }
@@ -0,0 +1,280 @@
+package handler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+const (
+	limiterWindow = time.Minute
+)
+
+// LockoutError indicates that login attempts are throttled for the client or storage
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("too many login attempts, retry after %s", e.RetryAfter)
+}
+
+// LoginLimits configures login brute force protection
+type LoginLimits struct {
+	// AttemptsPerMinute limits login attempts per client ip and per storage
+	AttemptsPerMinute int
+	// LockoutThreshold is the number of consecutive failures before lockout
+	LockoutThreshold int
+	// LockoutBase is the first lockout duration, it doubles with every next failure
+	LockoutBase time.Duration
+	// LockoutMax caps lockout duration
+	LockoutMax time.Duration
+}
+
+type limiterEntry struct {
+	windowStart time.Time
+	attempts    int
+	failures    int
+	lockedUntil time.Time
+}
+
+// loginLimiter throttles login attempts by client ip and target storage
+type loginLimiter struct {
+	mu        sync.Mutex
+	limits    LoginLimits
+	entries   map[string]*limiterEntry
+	nextSweep time.Time
+}
+
+func newLoginLimiter(limits LoginLimits) *loginLimiter {
+	return &loginLimiter{
+		limits:  limits,
+		entries: make(map[string]*limiterEntry),
+	}
+}
+
+// WithLoginLimits enables login brute force protection
+func WithLoginLimits(limits LoginLimits) Option {
+	return func(h *Handler) {
+		h.loginLimiter = newLoginLimiter(limits)
+	}
+}
+
+// WithTrustedProxies sets proxies which X-Forwarded-For header is trusted from
+// every entry is ip address or cidr
+func WithTrustedProxies(proxies []*net.IPNet) Option {
+	return func(h *Handler) {
+		h.trustedProxies = proxies
+	}
+}
+
+// ParseTrustedProxies converts ip addresses and cidrs to networks
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid proxy address: %s", p)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy cidr: %w", err)
+		}
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+func limiterKeys(ip string, storage string) []string {
+	return []string{ipLimiterKey(ip), storageLimiterKey(storage)}
+}
+
+func ipLimiterKey(ip string) string {
+	return "ip:" + ip
+}
+
+func storageLimiterKey(storage string) string {
+	return "storage:" + storage
+}
+
+// Allow registers login attempt and returns lockout error if attempt is not allowed
+func (l *loginLimiter) Allow(ip string, storage string) *httperror.Error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	var retryAfter time.Duration
+	for _, key := range limiterKeys(ip, storage) {
+		e := l.entry(key, now)
+
+		if now.Before(e.lockedUntil) {
+			retryAfter = maxDuration(retryAfter, e.lockedUntil.Sub(now))
+			continue
+		}
+
+		if now.Sub(e.windowStart) >= limiterWindow {
+			e.windowStart = now
+			e.attempts = 0
+		}
+
+		if l.limits.AttemptsPerMinute > 0 && e.attempts >= l.limits.AttemptsPerMinute {
+			retryAfter = maxDuration(retryAfter, e.windowStart.Add(limiterWindow).Sub(now))
+		}
+	}
+
+	if retryAfter > 0 {
+		return httperror.NewInternalError("too many login attempts").WithError(&LockoutError{RetryAfter: retryAfter})
+	}
+
+	for _, key := range limiterKeys(ip, storage) {
+		l.entries[key].attempts++
+	}
+
+	return nil
+}
+
+// Failure registers wrong password and locks client ip and storage after threshold
+func (l *loginLimiter) Failure(ip string, storage string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range limiterKeys(ip, storage) {
+		e := l.entry(key, now)
+		e.failures++
+
+		if e.failures < l.limits.LockoutThreshold {
+			continue
+		}
+
+		lockout := l.limits.LockoutBase << uint(minInt(e.failures-l.limits.LockoutThreshold, 30))
+		if lockout <= 0 || lockout > l.limits.LockoutMax {
+			lockout = l.limits.LockoutMax
+		}
+		e.lockedUntil = now.Add(lockout)
+	}
+}
+
+// Success resets failures of the storage after successful login
+// client ip failures are kept, otherwise login to own storage would unlock guessing passwords of the others
+func (l *loginLimiter) Success(ip string, storage string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e, ok := l.entries[storageLimiterKey(storage)]; ok {
+		e.failures = 0
+		e.lockedUntil = time.Time{}
+	}
+}
+
+func (l *loginLimiter) entry(key string, now time.Time) *limiterEntry {
+	e, ok := l.entries[key]
+	if !ok {
+		e = &limiterEntry{windowStart: now}
+		l.entries[key] = e
+	}
+	return e
+}
+
+// sweep removes idle entries, failures are forgotten after max lockout period without attempts
+func (l *loginLimiter) sweep(now time.Time) {
+	if now.Before(l.nextSweep) {
+		return
+	}
+
+	idle := maxDuration(l.limits.LockoutMax, limiterWindow)
+	for key, e := range l.entries {
+		if now.After(e.lockedUntil) && now.Sub(e.windowStart) > idle {
+			delete(l.entries, key)
+		}
+	}
+	l.nextSweep = now.Add(limiterWindow)
+}
+
+// clientIP returns address of the client
+// X-Forwarded-For is honoured only when request came from trusted proxy
+// the header is walked from the right so client cannot spoof address by prepending entries
+func (h *Handler) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !h.isTrustedProxy(host) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if addr == "" {
+			continue
+		}
+
+		if !h.isTrustedProxy(addr) {
+			return addr
+		}
+		host = addr
+	}
+
+	return host
+}
+
+func (h *Handler) isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range h.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
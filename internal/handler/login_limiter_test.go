@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginLimiterSuccessKeepsIPFailures(t *testing.T) {
+	l := newLoginLimiter(LoginLimits{
+		LockoutThreshold: 3,
+		LockoutBase:      time.Minute,
+		LockoutMax:       time.Hour,
+	})
+
+	for _, storage := range []string{"victim1", "victim2"} {
+		if err := l.Allow("10.0.0.1", storage); err != nil {
+			t.Fatalf("allow %s: %v", storage, err)
+		}
+		l.Failure("10.0.0.1", storage)
+	}
+
+	if err := l.Allow("10.0.0.1", "own"); err != nil {
+		t.Fatalf("allow own: %v", err)
+	}
+	l.Success("10.0.0.1", "own")
+
+	if err := l.Allow("10.0.0.1", "victim3"); err != nil {
+		t.Fatalf("allow victim3: %v", err)
+	}
+	l.Failure("10.0.0.1", "victim3")
+
+	if err := l.Allow("10.0.0.1", "victim4"); err == nil {
+		t.Fatal("ip is not locked after successful login to own storage")
+	}
+
+	if err := l.Allow("10.0.0.2", "victim4"); err != nil {
+		t.Fatalf("other ip is locked: %v", err)
+	}
+}
+
+func TestLoginLimiterSuccessResetsStorage(t *testing.T) {
+	l := newLoginLimiter(LoginLimits{
+		LockoutThreshold: 2,
+		LockoutBase:      time.Minute,
+		LockoutMax:       time.Hour,
+	})
+
+	l.Failure("10.0.0.1", "s1")
+	l.Failure("10.0.0.2", "s1")
+	if err := l.Allow("10.0.0.3", "s1"); err == nil {
+		t.Fatal("storage is not locked")
+	}
+
+	l.Success("10.0.0.3", "s1")
+	if err := l.Allow("10.0.0.3", "s1"); err != nil {
+		t.Fatalf("storage is locked after success: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+func newLoginRequest(storage string, form url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/login/"+storage+"/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return withRouterParameters(r, storage, false, "")
+}
+
+func TestLoginHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		form         url.Values
+		login        func(p gateway.Params) (string, *httperror.Error)
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+		wantToken    string
+		wantCalls    int
+		sessionErr   error
+	}{
+		{
+			name: "success",
+			form: url.Values{"password": {"secret"}},
+			login: func(p gateway.Params) (string, *httperror.Error) {
+				return "token", nil
+			},
+			wantStatus:   http.StatusFound,
+			wantLocation: "/s1",
+			wantToken:    "token",
+			wantCalls:    1,
+		},
+		{
+			name: "success with next",
+			form: url.Values{"password": {"secret"}, "next": {"/s1/a.txt/"}},
+			login: func(p gateway.Params) (string, *httperror.Error) {
+				return "token", nil
+			},
+			wantStatus:   http.StatusFound,
+			wantLocation: "/s1/a.txt/",
+			wantToken:    "token",
+			wantCalls:    1,
+		},
+		{
+			name: "external next is ignored",
+			form: url.Values{"password": {"secret"}, "next": {"//evil.example/"}},
+			login: func(p gateway.Params) (string, *httperror.Error) {
+				return "token", nil
+			},
+			wantStatus:   http.StatusFound,
+			wantLocation: "/s1",
+			wantToken:    "token",
+			wantCalls:    1,
+		},
+		{
+			name: "wrong password",
+			form: url.Values{"password": {"wrong"}},
+			login: func(p gateway.Params) (string, *httperror.Error) {
+				return "", httperror.NewNotMatchError("password does not match")
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "Invalid storage name or password",
+			wantCalls:  1,
+		},
+		{
+			name: "session is not stored",
+			form: url.Values{"password": {"secret"}},
+			login: func(p gateway.Params) (string, *httperror.Error) {
+				return "token", nil
+			},
+			sessionErr: errors.New("store is unavailable"),
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   "Unable to sign in, please try again",
+			wantCalls:  1,
+		},
+		{
+			name:       "empty password",
+			form:       url.Values{},
+			wantStatus: http.StatusOK,
+			wantBody:   "Please enter password to login",
+			wantCalls:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &fakeGateway{login: tt.login}
+			session := newFakeSession()
+			session.setErr = tt.sessionErr
+			h := New(gw, session, nopLogger{})
+
+			w := httptest.NewRecorder()
+			h.LoginHandler(w, newLoginRequest("s1", tt.form))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if loc := w.Header().Get("Location"); loc != tt.wantLocation {
+				t.Errorf("location = %q, want %q", loc, tt.wantLocation)
+			}
+
+			if tt.wantBody != "" && !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body does not contain %q", tt.wantBody)
+			}
+
+			if n := gw.called("login"); n != tt.wantCalls {
+				t.Fatalf("gateway login calls = %d, want %d", n, tt.wantCalls)
+			}
+
+			if tt.wantCalls > 0 {
+				values := gw.params[0].Values
+				if values.Get("storage") != "s1" || values.Get("password") != tt.form.Get("password") {
+					t.Errorf("gateway values = %v", values)
+				}
+			}
+
+			token := session.GetToken("s1", nil)
+			if tt.wantToken == "" {
+				if token != nil {
+					t.Fatalf("unexpected session token %q", token.Value)
+				}
+				return
+			}
+
+			if token == nil || token.Value != tt.wantToken || !token.SignIn {
+				t.Fatalf("session token = %+v, want %q with sign in", token, tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestLoginHandlerShowsForm(t *testing.T) {
+	gw := &fakeGateway{}
+	h := New(gw, newFakeSession(), nopLogger{})
+
+	w := httptest.NewRecorder()
+	r := withRouterParameters(httptest.NewRequest(http.MethodGet, "/login/s1/", nil), "s1", false, "")
+	h.LoginHandler(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	if len(gw.calls) != 0 {
+		t.Fatalf("unexpected gateway calls %v", gw.calls)
+	}
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+// LogoutHandler sign out from the requested storage or from all storages if storage is not specified
+// everywhere form value signs out the storage from all browsers if session store supports it
+func (h *Handler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	sp, err := h.requestParameters(r)
+	if err != nil {
+		h.Error(httperror.NewInvalidParams("request parametes").WithError(err), w, "LogoutHandler")
+		return
+	}
+
+	if sp.StorageName != "" && r.FormValue("everywhere") == "true" {
+		if h.session.GetToken(sp.StorageName, r) == nil {
+			h.Error(httperror.NewUnauthorized("not signed in to the storage"), w, "LogoutHandler")
+			return
+		}
+
+		revoker, httpErr := h.revoker()
+		if httpErr != nil {
+			h.Error(httpErr, w, "LogoutHandler")
+			return
+		}
+
+		if err := revoker.RevokeStorage(sp.StorageName); err != nil {
+			h.Error(httperror.NewInternalError("revoke sessions").WithError(err), w, "LogoutHandler")
+			return
+		}
+	}
+
+	if sp.StorageName != "" {
+		h.session.Remove(w, r, sp.StorageName)
+	} else {
+		for _, name := range h.session.Storages(r) {
+			h.session.Remove(w, r, name)
+		}
+	}
+
+	http.Redirect(w, r, "/storages/", http.StatusFound)
+}
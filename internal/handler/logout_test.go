@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLogoutHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		storage     string
+		wantSession []string
+	}{
+		{
+			name:        "single storage",
+			storage:     "s1",
+			wantSession: []string{"s2"},
+		},
+		{
+			name:        "all storages",
+			wantSession: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newFakeSession()
+			session.tokens["s1"] = &Token{Value: "t1"}
+			session.tokens["s2"] = &Token{Value: "t2"}
+			h := New(&fakeGateway{}, session, nopLogger{})
+
+			r := httptest.NewRequest(http.MethodPost, "/logout/", nil)
+			if tt.storage != "" {
+				r = withRouterParameters(r, tt.storage, false, "")
+			}
+
+			w := httptest.NewRecorder()
+			h.LogoutHandler(w, r)
+
+			if w.Code != http.StatusFound || w.Header().Get("Location") != "/storages/" {
+				t.Fatalf("status = %d, location = %q, want redirect to /storages/", w.Code, w.Header().Get("Location"))
+			}
+
+			names := session.Storages(nil)
+			sort.Strings(names)
+			if strings.Join(names, ",") != strings.Join(tt.wantSession, ",") {
+				t.Fatalf("signed in storages = %v, want %v", names, tt.wantSession)
+			}
+		})
+	}
+}
+
+func TestStoragesHandler(t *testing.T) {
+	session := newFakeSession()
+	session.tokens["beta"] = &Token{Value: "t1"}
+	session.tokens["alpha"] = &Token{Value: "t2"}
+	h := New(&fakeGateway{}, session, nopLogger{})
+
+	w := httptest.NewRecorder()
+	h.StoragesHandler(w, httptest.NewRequest(http.MethodGet, "/storages/", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	body := w.Body.String()
+	alpha, beta := strings.Index(body, "/logout/alpha/"), strings.Index(body, "/logout/beta/")
+	if alpha < 0 || beta < 0 || alpha > beta {
+		t.Fatalf("storages are not listed in order with logout forms")
+	}
+}
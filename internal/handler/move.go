@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+// MoveToPermanentHandler moves files listed in repeated fileName form values to the permanent folder
+// gateway has no move call so every file is copied and then removed, copy failure keeps the original
+func (h *Handler) MoveToPermanentHandler(w http.ResponseWriter, r *http.Request) {
+	names, httpErr := bulkFileNames(r)
+	if httpErr != nil {
+		h.Error(httpErr, w, "MoveToPermanentHandler")
+		return
+	}
+
+	sp, err := h.requestParameters(r)
+	if err != nil {
+		h.Error(httperror.NewInvalidParams("request parametes").WithError(err), w, "MoveToPermanentHandler")
+		return
+	}
+
+	if sp.IsPermanent || sp.IsPublic {
+		h.Error(httperror.NewInvalidParams("files can be moved from temporary folder only"), w, "MoveToPermanentHandler")
+		return
+	}
+
+	rsp, httpErr := h.bulkFiles(r, names, func(name string) *httperror.Error {
+		return h.moveToPermanent(r, w, sp, name)
+	})
+	if httpErr != nil {
+		h.Error(httpErr, w, "MoveToPermanentHandler")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rsp)
+}
+
+func (h *Handler) moveToPermanent(r *http.Request, w http.ResponseWriter, sp storageParameters, name string) *httperror.Error {
+	sp.FileName = name
+	rsp, httpErr := h.gw.File(r.Context(), h.gatewayParams(r, w, sp.StorageName, sp.Values()))
+	if httpErr != nil {
+		return h.gatewayError(r, w, sp.StorageName, httpErr)
+	}
+	defer rsp.Body.Close()
+
+	permanent := storageParameters{StorageName: sp.StorageName, IsPermanent: true}
+	body, contentType, errCh := fileBody(name, rsp.Body)
+	if httpErr := h.uploadStream(r, w, permanent, body, contentType, errCh); httpErr != nil {
+		return httpErr
+	}
+
+	if httpErr := h.gw.Remove(r.Context(), h.gatewayParams(r, w, sp.StorageName, sp.Values())); httpErr != nil {
+		return h.gatewayError(r, w, sp.StorageName, httpErr)
+	}
+
+	return nil
+}
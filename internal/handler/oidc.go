@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/oidc"
+	"github.com/Mikhalevich/filesharing-web-service/internal/template"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+const (
+	oidcStateCookieName = "oidc_state"
+	oidcStateMaxAge     = 10 * time.Minute
+	oidcCookiePath      = "/oidc/"
+)
+
+// CookieSealer encrypts and signs short lived cookies
+type CookieSealer interface {
+	Encode(name string, value string) (string, error)
+	Decode(name string, encoded string, maxAge time.Duration) (string, error)
+}
+
+// OIDC configures single sign on through OpenID Connect provider
+type OIDC struct {
+	Provider     *oidc.Provider
+	ACL          *oidc.ACL
+	Sealer       CookieSealer
+	SecureCookie bool
+}
+
+// WithOIDC enables OpenID Connect login next to the storage password
+func WithOIDC(o *OIDC) Option {
+	return func(h *Handler) {
+		h.oidc = o
+	}
+}
+
+// oidcState is kept in the sealed cookie between login redirect and callback
+type oidcState struct {
+	oidc.AuthRequest
+	Storage string `json:"storage"`
+	Next    string `json:"next"`
+}
+
+// oidcLoginURL returns single sign on url for the storage or empty string if sso is disabled
+func (h *Handler) oidcLoginURL(storageName string, next string) string {
+	if h.oidc == nil || storageName == "" {
+		return ""
+	}
+
+	u := fmt.Sprintf("/oidc/login/%s/", url.PathEscape(storageName))
+	if next != "" {
+		u += "?" + url.Values{"next": []string{next}}.Encode()
+	}
+	return u
+}
+
+// OIDCLoginHandler redirects browser to the identity provider
+func (h *Handler) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if h.oidc == nil {
+		h.Error(httperror.NewNotExistError("single sign on is disabled"), w, "OIDCLoginHandler")
+		return
+	}
+
+	sp, err := h.requestParameters(r)
+	if err != nil {
+		h.Error(httperror.NewInvalidParams("request parametes").WithError(err), w, "OIDCLoginHandler")
+		return
+	}
+
+	ar, err := oidc.NewAuthRequest()
+	if err != nil {
+		h.Error(httperror.NewInternalError("auth request").WithError(err), w, "OIDCLoginHandler")
+		return
+	}
+
+	authURL, err := h.oidc.Provider.AuthURL(r.Context(), ar)
+	if err != nil {
+		h.Error(httperror.NewInternalError("identity provider is unavailable").WithError(err), w, "OIDCLoginHandler")
+		return
+	}
+
+	state, err := json.Marshal(oidcState{
+		AuthRequest: ar,
+		Storage:     sp.StorageName,
+		Next:        nextURL(r, fmt.Sprintf("/%s/", sp.StorageName)),
+	})
+	if err != nil {
+		h.Error(httperror.NewInternalError("encode state").WithError(err), w, "OIDCLoginHandler")
+		return
+	}
+
+	sealed, err := h.oidc.Sealer.Encode(oidcStateCookieName, string(state))
+	if err != nil {
+		h.Error(httperror.NewInternalError("seal state").WithError(err), w, "OIDCLoginHandler")
+		return
+	}
+
+	http.SetCookie(w, h.oidcStateCookie(sealed, int(oidcStateMaxAge/time.Second)))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallbackHandler verifies identity provider response, checks acl and signs in to the storage
+func (h *Handler) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if h.oidc == nil {
+		h.Error(httperror.NewNotExistError("single sign on is disabled"), w, "OIDCCallbackHandler")
+		return
+	}
+
+	state, httpErr := h.oidcCallbackState(w, r)
+	if httpErr != nil {
+		h.Error(httpErr, w, "OIDCCallbackHandler")
+		return
+	}
+
+	if errCode := r.FormValue("error"); errCode != "" {
+		h.renderOIDCError(w, r, state, fmt.Sprintf("Single sign on failed: %s", errCode))
+		return
+	}
+
+	claims, idToken, err := h.oidc.Provider.Exchange(r.Context(), r.FormValue("code"), state.AuthRequest)
+	if err != nil {
+		h.logger.WithError(err).
+			WithField("storage", state.Storage).
+			Error("oidc code exchange")
+		h.renderOIDCError(w, r, state, "Single sign on failed, please try again")
+		return
+	}
+
+	if !h.oidc.ACL.Allowed(state.Storage, claims) {
+		h.logger.WithField("storage", state.Storage).
+			WithField("subject", claims.Subject).
+			Warn("oidc identity is not allowed")
+		h.renderOIDCError(w, r, state, "Your account has no access to this storage")
+		return
+	}
+
+	values := storageParameters{StorageName: state.Storage}.Values()
+	values.Add("subject", claims.Subject)
+	values.Add("id_token", idToken)
+
+	token, httpErr := h.gw.ExchangeToken(r.Context(), h.gatewayParams(r, w, state.Storage, values))
+	if httpErr != nil {
+		h.Error(h.gatewayError(r, w, state.Storage, httpErr), w, "OIDCCallbackHandler")
+		return
+	}
+
+	if err := h.session.SetToken(w, r, &Token{Value: token, SignIn: true}, state.Storage); err != nil {
+		h.Error(httperror.NewInternalError("unable to store session").WithError(err), w, "OIDCCallbackHandler")
+		return
+	}
+	http.Redirect(w, r, state.Next, http.StatusFound)
+}
+
+// oidcCallbackState reads state cookie, it is removed right away so the state cannot be replayed
+func (h *Handler) oidcCallbackState(w http.ResponseWriter, r *http.Request) (oidcState, *httperror.Error) {
+	cook, err := r.Cookie(oidcStateCookieName)
+	if err != nil {
+		return oidcState{}, httperror.NewInvalidParams("sign in state is missing").WithError(err)
+	}
+	http.SetCookie(w, h.oidcStateCookie("", -1))
+
+	value, err := h.oidc.Sealer.Decode(oidcStateCookieName, cook.Value, oidcStateMaxAge)
+	if err != nil {
+		return oidcState{}, httperror.NewInvalidParams("sign in state").WithError(err)
+	}
+
+	var state oidcState
+	if err := json.Unmarshal([]byte(value), &state); err != nil {
+		return oidcState{}, httperror.NewInvalidParams("sign in state").WithError(err)
+	}
+
+	if state.State == "" || r.FormValue("state") != state.State {
+		return oidcState{}, httperror.NewInvalidParams("sign in state").WithError(ErrCSRFToken)
+	}
+
+	return state, nil
+}
+
+func (h *Handler) renderOIDCError(w http.ResponseWriter, r *http.Request, state oidcState, message string) {
+	loginInfo := template.NewTemplatePassword()
+	loginInfo.CSRFToken = csrfToken(r)
+	loginInfo.SSOURL = h.oidcLoginURL(state.Storage, state.Next)
+	loginInfo.AddError("common", "%s", message)
+
+	w.WriteHeader(http.StatusUnauthorized)
+	if err := loginInfo.Execute(w); err != nil {
+		h.logger.Error(err)
+	}
+}
+
+func (h *Handler) oidcStateCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    value,
+		Path:     oidcCookiePath,
+		MaxAge:   maxAge,
+		Secure:   h.oidc.SecureCookie,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing-web-service/internal/oidc"
+	"github.com/Mikhalevich/filesharing-web-service/internal/oidc/oidctest"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+const (
+	testOIDCClientID = "web"
+)
+
+// plainSealer binds value to the cookie name without encryption
+type plainSealer struct{}
+
+func (plainSealer) Encode(name string, value string) (string, error) {
+	return url.QueryEscape(name + "|" + value), nil
+}
+
+func (plainSealer) Decode(name string, encoded string, maxAge time.Duration) (string, error) {
+	value, err := url.QueryUnescape(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasPrefix(value, name+"|") {
+		return "", errors.New("cookie name mismatch")
+	}
+	return strings.TrimPrefix(value, name+"|"), nil
+}
+
+type oidcTest struct {
+	idp     *oidctest.Server
+	gw      *fakeGateway
+	session *fakeSession
+	h       *Handler
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+
+	idp, err := oidctest.NewServer(testOIDCClientID)
+	if err != nil {
+		t.Fatalf("start identity provider: %v", err)
+	}
+	t.Cleanup(idp.Close)
+
+	gw := &fakeGateway{
+		tokenFn: func(endpoint string, p gateway.Params) (string, *httperror.Error) {
+			return "gateway-token", nil
+		},
+	}
+	session := newFakeSession()
+
+	h := New(gw, session, nopLogger{}, WithOIDC(&OIDC{
+		Provider: oidc.NewProvider(oidc.Config{
+			Issuer:      idp.URL,
+			ClientID:    testOIDCClientID,
+			RedirectURL: "http://web.example/oidc/callback/",
+		}, idp.Client()),
+		ACL: oidc.NewACL("", []oidc.ACLRule{
+			{Storage: "s1", Emails: []string{"user@example.com"}},
+		}),
+		Sealer: plainSealer{},
+	}))
+
+	return &oidcTest{idp: idp, gw: gw, session: session, h: h}
+}
+
+// login starts sign in to the storage and returns state cookie with authorization url
+func (ot *oidcTest) login(t *testing.T, storage string, next string) (*http.Cookie, string) {
+	t.Helper()
+
+	target := "/oidc/login/" + storage + "/"
+	if next != "" {
+		target += "?" + url.Values{"next": {next}}.Encode()
+	}
+
+	w := httptest.NewRecorder()
+	ot.h.OIDCLoginHandler(w, withRouterParameters(httptest.NewRequest(http.MethodGet, target, nil), storage, false, ""))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login status = %d, want %d: %s", w.Code, http.StatusFound, w.Body.String())
+	}
+
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcStateCookieName {
+			return c, w.Header().Get("Location")
+		}
+	}
+
+	t.Fatal("state cookie is not set")
+	return nil, ""
+}
+
+func (ot *oidcTest) callback(state *http.Cookie, query url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/oidc/callback/?"+query.Encode(), nil)
+	if state != nil {
+		r.AddCookie(state)
+	}
+
+	w := httptest.NewRecorder()
+	ot.h.OIDCCallbackHandler(w, r)
+	return w
+}
+
+var verifiedUser = map[string]interface{}{
+	"sub":            "user1",
+	"email":          "user@example.com",
+	"email_verified": true,
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	ot := newOIDCTest(t)
+
+	state, authURL := ot.login(t, "s1", "/s1/docs/")
+	code, stateValue, err := ot.idp.Authorize(authURL, verifiedUser)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+
+	w := ot.callback(state, url.Values{"code": {code}, "state": {stateValue}})
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusFound, w.Body.String())
+	}
+
+	if loc := w.Header().Get("Location"); loc != "/s1/docs/" {
+		t.Errorf("location = %q, want /s1/docs/", loc)
+	}
+
+	if n := ot.gw.called("exchangeToken"); n != 1 {
+		t.Fatalf("gateway exchangeToken calls = %d, want 1", n)
+	}
+
+	values := ot.gw.params[0].Values
+	if values.Get("subject") != "user1" || values.Get("id_token") == "" {
+		t.Errorf("gateway values = %v", values)
+	}
+
+	token := ot.session.GetToken("s1", nil)
+	if token == nil || token.Value != "gateway-token" || !token.SignIn {
+		t.Fatalf("session token = %+v, want gateway-token with sign in", token)
+	}
+
+	// state cookie is removed so the callback can not be replayed
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcStateCookieName && c.MaxAge >= 0 {
+			t.Errorf("state cookie is not removed: %+v", c)
+		}
+	}
+}
+
+func TestOIDCCallbackFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		// callback modifies the callback query and state cookie issued by the login
+		callback   func(ot *oidcTest, query url.Values, state *http.Cookie) (url.Values, *http.Cookie)
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "state mismatch",
+			callback: func(ot *oidcTest, query url.Values, state *http.Cookie) (url.Values, *http.Cookie) {
+				query.Set("state", "forged")
+				return query, state
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "state of other login",
+			callback: func(ot *oidcTest, query url.Values, state *http.Cookie) (url.Values, *http.Cookie) {
+				other, _ := ot.login(t, "s1", "")
+				return query, other
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "missing state cookie",
+			callback: func(ot *oidcTest, query url.Values, state *http.Cookie) (url.Values, *http.Cookie) {
+				return query, nil
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "token endpoint error",
+			callback: func(ot *oidcTest, query url.Values, state *http.Cookie) (url.Values, *http.Cookie) {
+				ot.idp.FailToken("invalid_grant")
+				return query, state
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   "Single sign on failed, please try again",
+		},
+		{
+			name: "provider error",
+			callback: func(ot *oidcTest, query url.Values, state *http.Cookie) (url.Values, *http.Cookie) {
+				return url.Values{"state": {query.Get("state")}, "error": {"access_denied%d"}}, state
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   "Single sign on failed: access_denied%d",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ot := newOIDCTest(t)
+
+			state, authURL := ot.login(t, "s1", "")
+			code, stateValue, err := ot.idp.Authorize(authURL, verifiedUser)
+			if err != nil {
+				t.Fatalf("authorize: %v", err)
+			}
+
+			query, cookie := tt.callback(ot, url.Values{"code": {code}, "state": {stateValue}}, state)
+			w := ot.callback(cookie, query)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if tt.wantBody != "" && !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body does not contain %q", tt.wantBody)
+			}
+
+			if n := ot.gw.called("exchangeToken"); n != 0 {
+				t.Fatalf("gateway exchangeToken calls = %d, want 0", n)
+			}
+
+			if token := ot.session.GetToken("s1", nil); token != nil {
+				t.Fatalf("unexpected session token %+v", token)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackACL(t *testing.T) {
+	ot := newOIDCTest(t)
+
+	state, authURL := ot.login(t, "s1", "")
+	code, stateValue, err := ot.idp.Authorize(authURL, map[string]interface{}{
+		"sub":            "user2",
+		"email":          "other@example.com",
+		"email_verified": true,
+	})
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+
+	w := ot.callback(state, url.Values{"code": {code}, "state": {stateValue}})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	if n := ot.gw.called("exchangeToken"); n != 0 {
+		t.Fatalf("gateway exchangeToken calls = %d, want 0", n)
+	}
+}
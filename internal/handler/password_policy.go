@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	minStorageNameLength = 3
+	maxStorageNameLength = 64
+	maxPasswordLength    = 128
+)
+
+var (
+	//go:embed data/common_passwords.txt
+	commonPasswordsData string
+
+	commonPasswords = loadCommonPasswords(commonPasswordsData)
+
+	// reservedStorageNames collide with routes or are kept for future ones
+	// short route prefixes(s, p) are not listed, they are rejected by the minimal name length
+	reservedStorageNames = map[string]bool{
+		"res":       true,
+		"login":     true,
+		"logout":    true,
+		"register":  true,
+		"permanent": true,
+		"storages":  true,
+		"api":       true,
+		"admin":     true,
+		"share":     true,
+		"settings":  true,
+		"auth":      true,
+		"static":    true,
+		"oidc":      true,
+		"common":    true,
+	}
+
+	// ErrWeakPassword indicates that password does not satisfy password policy
+	ErrWeakPassword = errors.New("weak password")
+	// ErrInvalidStorageName indicates that storage name does not satisfy naming rules
+	ErrInvalidStorageName = errors.New("invalid storage name")
+)
+
+// PasswordPolicy describes requirements for storage passwords
+type PasswordPolicy struct {
+	MinLength int
+	// MinClasses is the number of different character classes(lower, upper, digit, symbol) password should contain
+	MinClasses int
+}
+
+// WithPasswordPolicy sets password requirements for new storages
+func WithPasswordPolicy(p PasswordPolicy) Option {
+	return func(h *Handler) {
+		h.passwordPolicy = p
+	}
+}
+
+func loadCommonPasswords(data string) map[string]bool {
+	passwords := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		if p := strings.TrimSpace(scanner.Text()); p != "" {
+			passwords[strings.ToLower(p)] = true
+		}
+	}
+	return passwords
+}
+
+// Validate checks password against the policy
+func (p PasswordPolicy) Validate(storageName string, password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return fmt.Errorf("%w: password should be at least %d characters long", ErrWeakPassword, p.MinLength)
+	}
+
+	if length > maxPasswordLength {
+		return fmt.Errorf("%w: password should be at most %d characters long", ErrWeakPassword, maxPasswordLength)
+	}
+
+	if classes := characterClasses(password); classes < p.MinClasses {
+		return fmt.Errorf("%w: password should contain at least %d of lowercase letters, uppercase letters, digits and symbols", ErrWeakPassword, p.MinClasses)
+	}
+
+	lower := strings.ToLower(password)
+	if commonPasswords[lower] {
+		return fmt.Errorf("%w: password is too common", ErrWeakPassword)
+	}
+
+	if lower == strings.ToLower(storageName) {
+		return fmt.Errorf("%w: password should not match storage name", ErrWeakPassword)
+	}
+
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	return classes
+}
+
+// validateStorageName checks that storage name is safe to use as url path segment and cookie name
+func validateStorageName(name string) error {
+	if len(name) < minStorageNameLength || len(name) > maxStorageNameLength {
+		return fmt.Errorf("%w: name should be from %d to %d characters long", ErrInvalidStorageName, minStorageNameLength, maxStorageNameLength)
+	}
+
+	for i, r := range name {
+		isAlnum := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+		if i == 0 && !isAlnum {
+			return fmt.Errorf("%w: name should start with a letter or digit", ErrInvalidStorageName)
+		}
+
+		if !isAlnum && r != '-' && r != '_' {
+			return fmt.Errorf("%w: name may contain latin letters, digits, '-' and '_' only", ErrInvalidStorageName)
+		}
+	}
+
+	if reservedStorageNames[strings.ToLower(name)] {
+		return fmt.Errorf("%w: name %q is reserved", ErrInvalidStorageName, name)
+	}
+
+	return nil
+}
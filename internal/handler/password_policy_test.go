@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateStorageName(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage string
+		wantErr bool
+	}{
+		{name: "valid", storage: "docs_2021-backup"},
+		{name: "too short", storage: "ab", wantErr: true},
+		{name: "share route prefix", storage: "s", wantErr: true},
+		{name: "public page route prefix", storage: "p", wantErr: true},
+		{name: "too long", storage: strings.Repeat("a", maxStorageNameLength+1), wantErr: true},
+		{name: "starts with symbol", storage: "-docs", wantErr: true},
+		{name: "path separator", storage: "a/b/c", wantErr: true},
+		{name: "non latin", storage: "файлы", wantErr: true},
+		{name: "reserved route", storage: "settings", wantErr: true},
+		{name: "reserved route in upper case", storage: "Storages", wantErr: true},
+		{name: "default public storage", storage: "common", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateStorageName(tt.storage)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %t", err, tt.wantErr)
+			}
+
+			if err != nil && !errors.Is(err, ErrInvalidStorageName) {
+				t.Fatalf("error %v is not %v", err, ErrInvalidStorageName)
+			}
+		})
+	}
+}
+
+func TestReservedStorageNamesLength(t *testing.T) {
+	for name := range reservedStorageNames {
+		if len(name) < minStorageNameLength {
+			t.Errorf("reserved name %q is rejected by the length check already", name)
+		}
+	}
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, MinClasses: 3}
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{name: "valid", password: "Tr1cky-passphrase"},
+		{name: "too short", password: "Ab1-", wantErr: true},
+		{name: "too long", password: "Ab1-" + strings.Repeat("a", maxPasswordLength), wantErr: true},
+		{name: "few classes", password: "onlylowercase1", wantErr: true},
+		{name: "common", password: "Password1", wantErr: true},
+		{name: "storage name", password: "Docs-Storage1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate("docs-storage1", tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %t", err, tt.wantErr)
+			}
+
+			if err != nil && !errors.Is(err, ErrWeakPassword) {
+				t.Fatalf("error %v is not %v", err, ErrWeakPassword)
+			}
+		})
+	}
+}
@@ -0,0 +1,422 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/template"
+	"github.com/Mikhalevich/filesharing/pkg/ctxinfo"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+const (
+	publicPagePath        = "/p/"
+	viewerCookieName      = "public_view"
+	viewerSessionLifetime = 12 * time.Hour
+	maxPublicPages        = 20
+)
+
+// publicPageToken returns link token from /p/{token}/ and /p/{token}/{file}/ paths
+func publicPageToken(r *http.Request) string {
+	return strings.SplitN(strings.TrimPrefix(r.URL.Path, publicPagePath), "/", 2)[0]
+}
+
+func publicPageURL(token string) string {
+	return publicPagePath + token + "/"
+}
+
+// publicPage finds published page by request path
+func (h *Handler) publicPage(r *http.Request) (ShareLink, *httperror.Error) {
+	if h.shareLinks == nil {
+		return ShareLink{}, httperror.NewNotExistError("public pages are disabled")
+	}
+
+	id, ok := h.shareLinks.linkID(publicPageToken(r))
+	if !ok {
+		return ShareLink{}, httperror.NewNotExistError("page not found")
+	}
+
+	link, ok, err := h.shareLinks.Store.Get(id)
+	if err != nil {
+		return ShareLink{}, httperror.NewInternalError("share store").WithError(err)
+	}
+
+	if !ok || link.File != "" || link.Expired(time.Now()) {
+		return ShareLink{}, httperror.NewNotExistError("page not found")
+	}
+
+	return link, nil
+}
+
+// publicPageRequest makes request to the published storage folder authorized by the page gateway token
+func publicPageRequest(r *http.Request, link ShareLink) *http.Request {
+	ctx := ctxinfo.WithPublicStorage(r.Context(), false)
+	ctx = ctxinfo.WithUserName(ctx, link.Storage)
+	ctx = ctxinfo.WithPermanentStorage(ctx, link.Permanent)
+	return withGatewayToken(r.WithContext(ctx), link.GatewayToken)
+}
+
+func viewerSignature(key []byte, id string, expiresAt string) string {
+	return shareSignature(key, "viewer:"+id+":"+expiresAt)
+}
+
+// viewerSignedIn reports whether browser has entered viewer password of the page
+func (h *Handler) viewerSignedIn(r *http.Request, link ShareLink) bool {
+	if link.PasswordHash == "" {
+		return true
+	}
+
+	cook, err := r.Cookie(viewerCookieName)
+	if err != nil {
+		return false
+	}
+
+	parts := strings.Split(cook.Value, ".")
+	if len(parts) != 2 {
+		return false
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || time.Now().Unix() >= expiresAt {
+		return false
+	}
+
+	for _, key := range h.shareLinks.Keys {
+		if hmac.Equal([]byte(parts[1]), []byte(viewerSignature(key, link.ID, parts[0]))) {
+			return true
+		}
+	}
+	return false
+}
+
+// setViewerCookie remembers entered password for the page only
+func (h *Handler) setViewerCookie(w http.ResponseWriter, r *http.Request, link ShareLink) {
+	expiresAt := time.Now().Add(viewerSessionLifetime)
+	if !link.ExpiresAt.IsZero() && link.ExpiresAt.Before(expiresAt) {
+		expiresAt = link.ExpiresAt
+	}
+
+	exp := strconv.FormatInt(expiresAt.Unix(), 10)
+	http.SetCookie(w, &http.Cookie{
+		Name:     viewerCookieName,
+		Value:    exp + "." + viewerSignature(h.shareLinks.Keys[0], link.ID, exp),
+		Path:     publicPageURL(publicPageToken(r)),
+		Expires:  expiresAt,
+		Secure:   h.shareLinks.SecureCookie,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// PublicViewHandler shows read only view of the published storage folder
+// pages protected by viewer password ask for it first
+func (h *Handler) PublicViewHandler(w http.ResponseWriter, r *http.Request) {
+	link, httpErr := h.publicPage(r)
+	if httpErr != nil {
+		h.renderPublicPageError(w, httpErr)
+		return
+	}
+
+	if !h.viewerSignedIn(r, link) {
+		h.publicPagePassword(w, r, link)
+		return
+	}
+
+	sp := storageParameters{
+		StorageName: link.Storage,
+		IsPermanent: link.Permanent,
+	}
+
+	files, httpErr := h.listFiles(publicPageRequest(r, link), w, sp)
+	if httpErr != nil {
+		h.Error(httpErr, w, "PublicViewHandler")
+		return
+	}
+
+	fileInfos := make([]template.FileInfo, 0, len(files))
+	for _, f := range files {
+		fileInfos = append(fileInfos, template.FileInfo{
+			Name:    f.Name,
+			Size:    f.Size,
+			ModTime: f.ModTime,
+		})
+	}
+
+	viewTemplate := template.NewTemplateView(Title, false, fileInfos)
+	viewTemplate.Viewer = true
+	viewTemplate.StorageName = link.Storage
+
+	w.Header().Set("X-Robots-Tag", "noindex")
+	if err := viewTemplate.Execute(w); err != nil {
+		h.Error(httperror.NewInternalError("view error").WithError(err), w, "PublicViewHandler")
+		return
+	}
+}
+
+// publicPagePassword renders viewer password form and checks submitted password
+func (h *Handler) publicPagePassword(w http.ResponseWriter, r *http.Request, link ShareLink) {
+	pageInfo := template.NewTemplateShare(Title)
+	pageInfo.IsPage = true
+	pageInfo.FileName = link.Storage
+	pageInfo.ExpiresAt = expiresAtUnix(link.ExpiresAt)
+	pageInfo.NeedPassword = true
+	status := http.StatusOK
+	defer func() {
+		w.WriteHeader(status)
+		if err := pageInfo.Execute(w); err != nil {
+			h.logger.Error(err)
+		}
+	}()
+
+	if r.Method != http.MethodPost {
+		return
+	}
+
+	ip := h.clientIP(r)
+	limiterKey := "public:" + link.ID
+	if httpErr := h.loginLimiter.Allow(ip, limiterKey); httpErr != nil {
+		status = http.StatusTooManyRequests
+		setRetryAfter(w, httpErr)
+		pageInfo.AddError("password", "Too many attempts, please try again in %d seconds", retryAfterSeconds(httpErr))
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(r.FormValue("password"))) != nil {
+		h.loginLimiter.Failure(ip, limiterKey)
+		status = http.StatusUnauthorized
+		pageInfo.AddError("password", "Invalid password")
+		return
+	}
+
+	h.loginLimiter.Success(ip, limiterKey)
+	h.setViewerCookie(w, r, link)
+
+	status = http.StatusSeeOther
+	w.Header().Set("Location", publicPageURL(publicPageToken(r)))
+}
+
+// PublicFileHandler downloads file from the published storage folder
+func (h *Handler) PublicFileHandler(w http.ResponseWriter, r *http.Request) {
+	link, httpErr := h.publicPage(r)
+	if httpErr != nil {
+		h.renderPublicPageError(w, httpErr)
+		return
+	}
+
+	if !h.viewerSignedIn(r, link) {
+		http.Redirect(w, r, publicPageURL(publicPageToken(r)), http.StatusFound)
+		return
+	}
+
+	h.GetFileHandler(w, publicPageRequest(r, link))
+}
+
+// PublicArchiveHandler downloads files of the published storage folder as archive
+func (h *Handler) PublicArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	link, httpErr := h.publicPage(r)
+	if httpErr != nil {
+		h.renderPublicPageError(w, httpErr)
+		return
+	}
+
+	if !h.viewerSignedIn(r, link) {
+		http.Redirect(w, r, publicPageURL(publicPageToken(r)), http.StatusSeeOther)
+		return
+	}
+
+	h.ArchiveHandler(w, publicPageRequest(r, link))
+}
+
+func (h *Handler) renderPublicPageError(w http.ResponseWriter, httpErr *httperror.Error) {
+	if httpErr.Code != httperror.CodeNotExist {
+		h.Error(httpErr, w, "PublicViewHandler")
+		return
+	}
+
+	pageInfo := template.NewTemplateShare(Title)
+	pageInfo.IsPage = true
+	pageInfo.AddError("common", "Page not found or has expired")
+
+	w.WriteHeader(http.StatusNotFound)
+	if err := pageInfo.Execute(w); err != nil {
+		h.logger.Error(err)
+	}
+}
+
+func expiresAtUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// PublicPagesHandler lists published pages of the storage and publishes new ones
+func (h *Handler) PublicPagesHandler(w http.ResponseWriter, r *http.Request) {
+	if h.shareLinks == nil {
+		h.Error(httperror.NewNotExistError("public pages are disabled"), w, "PublicPagesHandler")
+		return
+	}
+
+	sp, err := h.requestParameters(r)
+	if err != nil {
+		h.Error(httperror.NewInvalidParams("request parametes").WithError(err), w, "PublicPagesHandler")
+		return
+	}
+
+	pagesInfo := template.NewTemplatePublicPages(Title, sp.StorageName)
+	pagesInfo.CSRFToken = csrfToken(r)
+
+	if r.Method == http.MethodPost {
+		if httpErr := h.publishPage(r, w, sp, pagesInfo); httpErr != nil {
+			h.Error(httpErr, w, "PublicPagesHandler")
+			return
+		}
+	}
+
+	pages, httpErr := h.publicPages(sp.StorageName)
+	if httpErr != nil {
+		h.Error(httpErr, w, "PublicPagesHandler")
+		return
+	}
+
+	now := time.Now()
+	for _, p := range pages {
+		pagesInfo.Pages = append(pagesInfo.Pages, template.PublicPageInfo{
+			ID:          p.ID,
+			URL:         publicPageURL(h.shareLinks.token(p.ID)),
+			Permanent:   p.Permanent,
+			HasPassword: p.PasswordHash != "",
+			CreatedAt:   p.CreatedAt.Unix(),
+			ExpiresAt:   expiresAtUnix(p.ExpiresAt),
+			Expired:     p.Expired(now),
+		})
+	}
+
+	if err := pagesInfo.Execute(w); err != nil {
+		h.logger.Error(err)
+	}
+}
+
+// publicPages returns published pages of the storage, newest first
+func (h *Handler) publicPages(storageName string) ([]ShareLink, *httperror.Error) {
+	links, err := h.shareLinks.Store.List(storageName)
+	if err != nil {
+		return nil, httperror.NewInternalError("list public pages").WithError(err)
+	}
+
+	pages := make([]ShareLink, 0, len(links))
+	for _, l := range links {
+		if l.File == "" {
+			pages = append(pages, l)
+		}
+	}
+
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].CreatedAt.After(pages[j].CreatedAt)
+	})
+
+	return pages, nil
+}
+
+// publishPage validates the form and publishes storage folder
+// form errors are added to the template, returned error is fatal for the page
+func (h *Handler) publishPage(r *http.Request, w http.ResponseWriter, sp storageParameters, pagesInfo *template.TemplatePublicPages) *httperror.Error {
+	sp.IsPermanent = r.FormValue("folder") == "permanent"
+
+	password := r.FormValue("password")
+	if len(password) > maxSharePasswordSize {
+		pagesInfo.AddError("password", "password should be at most %d bytes long", maxSharePasswordSize)
+	}
+
+	var expiresAt time.Time
+	if days := r.FormValue("expires_in_days"); days != "" && days != "0" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			pagesInfo.AddError("expires", "invalid expiration")
+		} else {
+			expiresAt = time.Now().Add(time.Duration(n) * 24 * time.Hour)
+		}
+	}
+
+	if len(pagesInfo.Errors) > 0 {
+		return nil
+	}
+
+	pages, httpErr := h.publicPages(sp.StorageName)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	if len(pages) >= maxPublicPages {
+		pagesInfo.AddError("common", "storage has too many public pages, please remove unused ones")
+		return nil
+	}
+
+	var passwordHash string
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return httperror.NewInternalError("hash password").WithError(err)
+		}
+		passwordHash = string(hash)
+	}
+
+	id, err := newShareLinkID()
+	if err != nil {
+		return httperror.NewInternalError("public page id").WithError(err)
+	}
+
+	values := sp.Values()
+	values.Add("scope", ScopeRead)
+	if !expiresAt.IsZero() {
+		values.Add("expires_at", strconv.FormatInt(expiresAt.Unix(), 10))
+	}
+
+	gatewayToken, httpErr := h.gw.IssueToken(r.Context(), h.gatewayParams(r, w, sp.StorageName, values))
+	if httpErr != nil {
+		return h.gatewayError(r, w, sp.StorageName, httpErr)
+	}
+
+	err = h.shareLinks.Store.Save(ShareLink{
+		ID:           id,
+		Storage:      sp.StorageName,
+		Permanent:    sp.IsPermanent,
+		PasswordHash: passwordHash,
+		GatewayToken: gatewayToken,
+		CreatedAt:    time.Now(),
+		ExpiresAt:    expiresAt,
+	})
+	if err != nil {
+		return httperror.NewInternalError("save public page").WithError(err)
+	}
+
+	return nil
+}
+
+// RevokePublicPageHandler unpublishes the page
+func (h *Handler) RevokePublicPageHandler(w http.ResponseWriter, r *http.Request) {
+	if h.shareLinks == nil {
+		h.Error(httperror.NewNotExistError("public pages are disabled"), w, "RevokePublicPageHandler")
+		return
+	}
+
+	sp, err := h.requestParameters(r)
+	if err != nil {
+		h.Error(httperror.NewInvalidParams("request parametes").WithError(err), w, "RevokePublicPageHandler")
+		return
+	}
+
+	if err := h.shareLinks.Store.Delete(sp.StorageName, r.FormValue("id")); err != nil {
+		h.Error(httperror.NewInternalError("revoke public page").WithError(err), w, "RevokePublicPageHandler")
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/settings/%s/public/", sp.StorageName), http.StatusFound)
+}
@@ -0,0 +1,261 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+type publicPageTest struct {
+	store      *fakeShareStore
+	shareLinks *ShareLinks
+	gw         *fakeGateway
+	h          *Handler
+}
+
+func newPublicPageTest(t *testing.T) *publicPageTest {
+	t.Helper()
+
+	store := &fakeShareStore{links: make(map[string]ShareLink)}
+	shareLinks := &ShareLinks{Store: store, Keys: [][]byte{[]byte("0123456789abcdef0123456789abcdef")}}
+	gw := &fakeGateway{
+		list: func(p gateway.Params) ([]gateway.File, *httperror.Error) {
+			return []gateway.File{testFile}, nil
+		},
+		tokenFn: func(endpoint string, p gateway.Params) (string, *httperror.Error) {
+			return "page-token", nil
+		},
+	}
+
+	return &publicPageTest{
+		store:      store,
+		shareLinks: shareLinks,
+		gw:         gw,
+		h:          New(gw, newFakeSession(), nopLogger{}, WithShareLinks(shareLinks)),
+	}
+}
+
+// publish stores page of the storage folder protected by the password if it is not empty
+func (pt *publicPageTest) publish(t *testing.T, password string, expiresAt time.Time) string {
+	t.Helper()
+
+	link := ShareLink{
+		ID:           "page1",
+		Storage:      "s1",
+		GatewayToken: "page-token",
+		CreatedAt:    time.Now(),
+		ExpiresAt:    expiresAt,
+	}
+
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatalf("hash password: %v", err)
+		}
+		link.PasswordHash = string(hash)
+	}
+
+	pt.store.Save(link)
+	return publicPageURL(pt.shareLinks.token(link.ID))
+}
+
+func TestPublicViewHandler(t *testing.T) {
+	pt := newPublicPageTest(t)
+	pageURL := pt.publish(t, "", time.Time{})
+
+	w := httptest.NewRecorder()
+	pt.h.PublicViewHandler(w, httptest.NewRequest(http.MethodGet, pageURL, nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	if !strings.Contains(w.Body.String(), testFile.Name) {
+		t.Errorf("file list does not contain %s", testFile.Name)
+	}
+
+	if got := w.Header().Get("X-Robots-Tag"); got != "noindex" {
+		t.Errorf("x-robots-tag = %q, want noindex", got)
+	}
+
+	if n := pt.gw.called("list"); n != 1 {
+		t.Fatalf("gateway list calls = %d, want 1", n)
+	}
+
+	p := pt.gw.params[0]
+	if p.Token != "page-token" || p.Values.Get("storage") != "s1" {
+		t.Errorf("gateway params = %+v, want page token for s1", p)
+	}
+}
+
+func TestPublicViewHandlerNotFound(t *testing.T) {
+	tests := []struct {
+		name string
+		url  func(t *testing.T, pt *publicPageTest) string
+	}{
+		{
+			name: "unknown page",
+			url: func(t *testing.T, pt *publicPageTest) string {
+				return publicPageURL(pt.shareLinks.token("unknown"))
+			},
+		},
+		{
+			name: "forged token",
+			url: func(t *testing.T, pt *publicPageTest) string {
+				return publicPageURL("page1.forged")
+			},
+		},
+		{
+			name: "expired page",
+			url: func(t *testing.T, pt *publicPageTest) string {
+				return pt.publish(t, "", time.Now().Add(-time.Minute))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt := newPublicPageTest(t)
+
+			w := httptest.NewRecorder()
+			pt.h.PublicViewHandler(w, httptest.NewRequest(http.MethodGet, tt.url(t, pt), nil))
+
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusNotFound)
+			}
+
+			if pt.gw.called("list") != 0 {
+				t.Errorf("gateway is called for missing page")
+			}
+		})
+	}
+}
+
+func TestPublicViewHandlerPassword(t *testing.T) {
+	pt := newPublicPageTest(t)
+	pageURL := pt.publish(t, "viewer-secret", time.Time{})
+
+	submit := func(password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, pageURL, strings.NewReader(url.Values{"password": {password}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		pt.h.PublicViewHandler(w, r)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	pt.h.PublicViewHandler(w, httptest.NewRequest(http.MethodGet, pageURL, nil))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), testFile.Name) {
+		t.Fatalf("page is shown without password: status = %d", w.Code)
+	}
+
+	if w := submit("wrong"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	w = submit("viewer-secret")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != pageURL {
+		t.Fatalf("status = %d, location = %q, want redirect to the page", w.Code, w.Header().Get("Location"))
+	}
+
+	viewer := responseViewerCookie(t, w)
+	if viewer.Path != pageURL || !viewer.HttpOnly {
+		t.Errorf("viewer cookie = %+v, want http only cookie of the page", viewer)
+	}
+
+	if pt.gw.called("list") != 0 {
+		t.Fatalf("gateway is called before password is entered")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, pageURL, nil)
+	r.AddCookie(viewer)
+	w = httptest.NewRecorder()
+	pt.h.PublicViewHandler(w, r)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), testFile.Name) {
+		t.Fatalf("page is not shown with viewer cookie: status = %d", w.Code)
+	}
+
+	// viewer cookie of the page does not open other pages
+	other := ShareLink{ID: "page2", Storage: "s2", GatewayToken: "other-token", PasswordHash: pt.store.links["page1"].PasswordHash}
+	pt.store.Save(other)
+	r = httptest.NewRequest(http.MethodGet, publicPageURL(pt.shareLinks.token(other.ID)), nil)
+	r.AddCookie(viewer)
+	w = httptest.NewRecorder()
+	pt.h.PublicViewHandler(w, r)
+	if strings.Contains(w.Body.String(), testFile.Name) {
+		t.Fatalf("viewer cookie opens other page")
+	}
+}
+
+func TestPublicFileHandlerRequiresPassword(t *testing.T) {
+	pt := newPublicPageTest(t)
+	pageURL := pt.publish(t, "viewer-secret", time.Time{})
+
+	w := httptest.NewRecorder()
+	pt.h.PublicFileHandler(w, httptest.NewRequest(http.MethodGet, pageURL+testFile.Name+"/", nil))
+
+	if w.Code != http.StatusFound || w.Header().Get("Location") != pageURL {
+		t.Fatalf("status = %d, location = %q, want redirect to the page", w.Code, w.Header().Get("Location"))
+	}
+
+	if pt.gw.called("file") != 0 {
+		t.Fatalf("file is downloaded without password")
+	}
+}
+
+func TestPublicPagesHandlerPublishes(t *testing.T) {
+	pt := newPublicPageTest(t)
+	session := pt.h.session.(*fakeSession)
+	session.tokens["s1"] = &Token{Value: "owner-token"}
+
+	form := url.Values{"folder": {"permanent"}, "expires_in_days": {"7"}}
+	r := httptest.NewRequest(http.MethodPost, "/settings/s1/public/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+	pt.h.PublicPagesHandler(w, withRouterParameters(r, "s1", false, ""))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	if n := pt.gw.called("issueToken"); n != 1 {
+		t.Fatalf("gateway issueToken calls = %d, want 1", n)
+	}
+
+	p := pt.gw.params[0]
+	if p.Token != "owner-token" || p.Values.Get("scope") != ScopeRead || p.Values.Get("permanent") != "true" || p.Values.Get("expires_at") == "" {
+		t.Errorf("gateway params = %+v, want read token of permanent folder with expiration", p)
+	}
+
+	if len(pt.store.links) != 1 {
+		t.Fatalf("published pages = %d, want 1", len(pt.store.links))
+	}
+
+	for _, l := range pt.store.links {
+		if l.Storage != "s1" || !l.Permanent || l.GatewayToken != "page-token" || l.File != "" || l.ExpiresAt.IsZero() {
+			t.Errorf("published page = %+v", l)
+		}
+	}
+}
+
+func responseViewerCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+
+	for _, c := range w.Result().Cookies() {
+		if c.Name == viewerCookieName {
+			return c
+		}
+	}
+
+	t.Fatal("viewer cookie is not set")
+	return nil
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+)
+
+// WithTokenRefresh enables proactive refresh of session tokens expiring within before duration
+func WithTokenRefresh(before time.Duration) Option {
+	return func(h *Handler) {
+		h.refreshBefore = before
+	}
+}
+
+// refreshToken asks gateway for the new token when the session one is close to expiring
+// refresh failure is not fatal, the current token is still valid
+func (h *Handler) refreshToken(r *http.Request, w http.ResponseWriter, storageName string, token string) {
+	if h.refreshBefore <= 0 {
+		return
+	}
+
+	expiresAt, ok := tokenExpiry(token)
+	if !ok || time.Until(expiresAt) > h.refreshBefore {
+		return
+	}
+
+	newToken, httpErr := h.gw.Refresh(r.Context(), gateway.Params{Token: token})
+	if httpErr != nil {
+		h.logger.WithError(httpErr).
+			WithField("storage", storageName).
+			Warn("unable to refresh token")
+		return
+	}
+
+	if err := h.session.SetToken(w, r, &Token{Value: newToken}, storageName); err != nil {
+		h.logger.WithError(err).
+			WithField("storage", storageName).
+			Warn("unable to store refreshed token")
+	}
+}
+
+// tokenExpiry reads exp claim from jwt token without signature verification
+// the token is verified by the gateway, web service needs expiration time only
+func tokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var claims struct {
+		ExpiresAt int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.ExpiresAt == 0 {
+		return time.Time{}, false
+	}
+
+	return time.Unix(claims.ExpiresAt, 0), true
+}
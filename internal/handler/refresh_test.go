@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+// testJWT makes unsigned jwt with the exp claim, web service does not verify signatures
+func testJWT(expiresAt time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, expiresAt.Unix())))
+	return "header." + payload + ".signature"
+}
+
+func TestCheckAuthMiddlewareRefreshesToken(t *testing.T) {
+	expiring := testJWT(time.Now().Add(time.Minute))
+	fresh := testJWT(time.Now().Add(2 * time.Hour))
+
+	tests := []struct {
+		name        string
+		token       string
+		before      time.Duration
+		refreshErr  *httperror.Error
+		bearer      bool
+		wantRefresh bool
+		wantToken   string
+	}{
+		{name: "expiring token", token: expiring, before: time.Hour, wantRefresh: true, wantToken: "refreshed"},
+		{name: "fresh token", token: fresh, before: time.Hour, wantToken: fresh},
+		{name: "refresh disabled", token: expiring, wantToken: expiring},
+		{name: "opaque token", token: "opaque", before: time.Hour, wantToken: "opaque"},
+		{name: "bearer token", token: expiring, before: time.Hour, bearer: true},
+		{
+			name:        "refresh failure keeps token",
+			token:       expiring,
+			before:      time.Hour,
+			refreshErr:  httperror.NewUnauthorized("token is revoked"),
+			wantRefresh: true,
+			wantToken:   expiring,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &fakeGateway{
+				tokenFn: func(endpoint string, p gateway.Params) (string, *httperror.Error) {
+					if tt.refreshErr != nil {
+						return "", tt.refreshErr
+					}
+					return "refreshed", nil
+				},
+			}
+			session := newFakeSession()
+			h := New(gw, session, nopLogger{}, WithTokenRefresh(tt.before))
+
+			r := httptest.NewRequest(http.MethodGet, "/s1/", nil)
+			if tt.bearer {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			} else {
+				session.tokens["s1"] = &Token{Value: tt.token}
+			}
+
+			served := false
+			w := httptest.NewRecorder()
+			h.CheckAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = true
+			})).ServeHTTP(w, withRouterParameters(r, "s1", false, ""))
+
+			if !served {
+				t.Fatalf("request is not served: status = %d", w.Code)
+			}
+
+			if refreshed := gw.called("refresh") == 1; refreshed != tt.wantRefresh {
+				t.Fatalf("refreshed = %t, want %t", refreshed, tt.wantRefresh)
+			}
+
+			if tt.wantRefresh && gw.params[0].Token != tt.token {
+				t.Errorf("refresh token = %q, want %q", gw.params[0].Token, tt.token)
+			}
+
+			if tt.bearer {
+				if len(session.tokens) != 0 {
+					t.Errorf("bearer token is stored in session")
+				}
+				return
+			}
+
+			if got := session.tokens["s1"].Value; got != tt.wantToken {
+				t.Errorf("session token = %q, want %q", got, tt.wantToken)
+			}
+		})
+	}
+}
@@ -2,7 +2,6 @@ package handler
 
 import (
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 
@@ -13,6 +12,7 @@ import (
 // RegisterHandler register a new storage(user)
 func (h *Handler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	userInfo := template.NewTemplateRegister()
+	userInfo.CSRFToken = csrfToken(r)
 	renderTemplate := true
 
 	defer func() {
@@ -35,31 +35,50 @@ func (h *Handler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	values := url.Values{}
-	values.Add("storage", userInfo.StorageName)
-	values.Add("password", userInfo.Password)
+	if err := validateStorageName(userInfo.StorageName); err != nil {
+		userInfo.AddError("name", "%s", err)
+		return
+	}
+
+	if userInfo.Password != r.FormValue("confirm") {
+		userInfo.AddError("confirm", "passwords do not match")
+		return
+	}
 
-	rsp, httpErr := h.makePostRequest(r, w, userInfo.StorageName, "register", values)
+	if err := h.passwordPolicy.Validate(userInfo.StorageName, userInfo.Password); err != nil {
+		userInfo.AddError("password", "%s", err)
+		return
+	}
+
+	values := registerValues(userInfo.StorageName, userInfo.Password)
+
+	token, httpErr := h.gw.Register(r.Context(), h.gatewayParams(r, w, userInfo.StorageName, values))
 	if httpErr != nil {
 		switch httpErr.Code {
 		case httperror.CodeAlreadyExist:
 			userInfo.AddError("common", "storage with this name already exists")
 		default:
-			userInfo.AddError("common", httpErr.Description)
+			userInfo.AddError("common", "%s", httpErr.Description)
 		}
 		return
 	}
 
-	defer rsp.Body.Close()
-
-	token, err := ioutil.ReadAll(rsp.Body)
-	if err != nil {
-		h.Error(httperror.NewInternalError("invalid session token").WithError(err), w, "RegisterHandler")
+	if err := h.session.SetToken(w, r, &Token{Value: token, SignIn: true}, userInfo.StorageName); err != nil {
+		h.logger.WithError(err).
+			WithField("storage", userInfo.StorageName).
+			Error("unable to store session")
+		userInfo.AddError("common", "storage is created but sign in failed, please login")
 		return
 	}
 
-	h.session.SetToken(w, &Token{Value: string(token)}, userInfo.StorageName)
-
 	renderTemplate = false
 	http.Redirect(w, r, fmt.Sprintf("/%s", userInfo.StorageName), http.StatusFound)
 }
+
+// registerValues makes gateway register parameters
+func registerValues(name string, password string) url.Values {
+	values := url.Values{}
+	values.Add("storage", name)
+	values.Add("password", password)
+	return values
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+func TestRegisterHandlerGatewayValues(t *testing.T) {
+	gw := &fakeGateway{
+		tokenFn: func(endpoint string, p gateway.Params) (string, *httperror.Error) {
+			return "token", nil
+		},
+	}
+	session := newFakeSession()
+	h := New(gw, session, nopLogger{})
+
+	form := url.Values{
+		"name":     {"docs"},
+		"password": {"Tr1cky-passphrase"},
+		"confirm":  {"Tr1cky-passphrase"},
+	}
+	r := httptest.NewRequest(http.MethodPost, "/register/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+	h.RegisterHandler(w, r)
+
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/docs" {
+		t.Fatalf("status = %d, location = %q, want redirect to /docs", w.Code, w.Header().Get("Location"))
+	}
+
+	if n := gw.called("register"); n != 1 {
+		t.Fatalf("gateway register calls = %d, want 1", n)
+	}
+
+	want := url.Values{"storage": {"docs"}, "password": {"Tr1cky-passphrase"}}
+	if got := gw.params[0].Values; !reflect.DeepEqual(got, want) {
+		t.Fatalf("gateway values = %v, want %v", got, want)
+	}
+
+	if token := session.GetToken("docs", nil); token == nil || token.Value != "token" {
+		t.Fatalf("session token = %+v, want token", token)
+	}
+}
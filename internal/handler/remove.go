@@ -6,26 +6,33 @@ import (
 	"github.com/Mikhalevich/filesharing/pkg/httperror"
 )
 
-// RemoveHandler removes current file from storage
+// RemoveHandler removes files listed in repeated fileName form values from storage
+// responds with per file results
 func (h *Handler) RemoveHandler(w http.ResponseWriter, r *http.Request) {
-	fileName := r.FormValue("fileName")
-	if fileName == "" {
-		h.Error(httperror.NewInvalidParams("file name was not set"), w, "RemoveHandler")
+	names, httpErr := bulkFileNames(r)
+	if httpErr != nil {
+		h.Error(httpErr, w, "RemoveHandler")
 		return
 	}
 
 	sp, err := h.requestParameters(r)
 	if err != nil {
-		h.Error(httperror.NewInternalError("request parametes").WithError(err), w, "RemoveHandler")
+		h.Error(httperror.NewInvalidParams("request parametes").WithError(err), w, "RemoveHandler")
 		return
 	}
 
-	rsp, httpErr := h.makePostRequest(r, w, sp.StorageName, "remove", sp.Values())
+	rsp, httpErr := h.bulkFiles(r, names, func(name string) *httperror.Error {
+		fileSP := sp
+		fileSP.FileName = name
+		if httpErr := h.gw.Remove(r.Context(), h.gatewayParams(r, w, sp.StorageName, fileSP.Values())); httpErr != nil {
+			return h.gatewayError(r, w, sp.StorageName, httpErr)
+		}
+		return nil
+	})
 	if httpErr != nil {
 		h.Error(httpErr, w, "RemoveHandler")
 		return
 	}
 
-	defer rsp.Body.Close()
-	w.WriteHeader(http.StatusOK)
+	writeJSON(w, http.StatusOK, rsp)
 }
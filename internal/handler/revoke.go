@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+// Revoker is implemented by server side sessions which are able to sign out storage from all browsers
+type Revoker interface {
+	RevokeStorage(name string) error
+}
+
+// WithAdminToken enables admin api authorized by the bearer token
+func WithAdminToken(token string) Option {
+	return func(h *Handler) {
+		h.adminToken = token
+	}
+}
+
+func (h *Handler) revoker() (Revoker, *httperror.Error) {
+	revoker, ok := h.session.(Revoker)
+	if !ok {
+		return nil, httperror.NewInternalError("session revocation is not supported by session store")
+	}
+	return revoker, nil
+}
+
+// AdminRevokeHandler signs out storage from all browser sessions
+func (h *Handler) AdminRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	if h.adminToken == "" {
+		h.APIError(httperror.NewNotExistError("admin api is disabled"), w, "AdminRevokeHandler")
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(bearerToken(r)), []byte(h.adminToken)) != 1 {
+		h.APIError(httperror.NewUnauthorized("invalid admin token"), w, "AdminRevokeHandler")
+		return
+	}
+
+	sp, err := h.requestParameters(r)
+	if err != nil {
+		h.APIError(httperror.NewInvalidParams("request parametes").WithError(err), w, "AdminRevokeHandler")
+		return
+	}
+
+	revoker, httpErr := h.revoker()
+	if httpErr != nil {
+		h.APIError(httpErr, w, "AdminRevokeHandler")
+		return
+	}
+
+	if err := revoker.RevokeStorage(sp.StorageName); err != nil {
+		h.APIError(httperror.NewInternalError("revoke sessions").WithError(err), w, "AdminRevokeHandler")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,356 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing-web-service/internal/template"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+const (
+	shareLinkPath        = "/s/"
+	shareLinkIDLength    = 16
+	shareLinkSigLength   = 16
+	maxShareDownloads    = 1000
+	maxSharePasswordSize = 72 // bcrypt limit
+)
+
+var (
+	// ErrShareLinkGone indicates that share link is expired, exhausted or removed
+	ErrShareLinkGone = errors.New("share link is gone")
+)
+
+// ShareLink grants access to the single file without storage session
+// link without file is public page of the whole storage folder
+type ShareLink struct {
+	ID        string `json:"id"`
+	Storage   string `json:"storage"`
+	File      string `json:"file,omitempty"`
+	Permanent bool   `json:"permanent"`
+	// MaxDownloads zero value means downloads are limited by expiration only
+	MaxDownloads int       `json:"max_downloads"`
+	Downloads    int       `json:"downloads"`
+	PasswordHash string    `json:"password_hash,omitempty"`
+	GatewayToken string    `json:"gateway_token"`
+	CreatedAt    time.Time `json:"created_at"`
+	// ExpiresAt zero value means link never expires
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Expired reports whether link is expired at the moment
+func (l ShareLink) Expired(now time.Time) bool {
+	return !l.ExpiresAt.IsZero() && !now.Before(l.ExpiresAt)
+}
+
+// Available reports whether link can still be downloaded
+func (l ShareLink) Available(now time.Time) bool {
+	if l.Expired(now) {
+		return false
+	}
+	return l.MaxDownloads == 0 || l.Downloads < l.MaxDownloads
+}
+
+// ShareStore keeps share links and their download counters
+type ShareStore interface {
+	Get(id string) (ShareLink, bool, error)
+	List(storage string) ([]ShareLink, error)
+	Save(l ShareLink) error
+	// Use atomically counts download, ErrShareLinkGone is returned for unavailable links
+	Use(id string, now time.Time) (ShareLink, error)
+	Delete(storage string, id string) error
+	// DeleteStorage removes all links of the storage
+	DeleteStorage(storage string) error
+}
+
+// ShareLinks configures share links for individual files and public storage pages
+type ShareLinks struct {
+	Store ShareStore
+	// Keys sign link tokens, the first one signs new links, all of them are accepted for rotation
+	Keys [][]byte
+	// MaxTTL limits lifetime of single file links
+	MaxTTL time.Duration
+	// SecureCookie sets secure attribute of public page viewer cookie
+	SecureCookie bool
+}
+
+// WithShareLinks enables share links
+func WithShareLinks(sl *ShareLinks) Option {
+	return func(h *Handler) {
+		h.shareLinks = sl
+	}
+}
+
+// shareSignature binds link id to the service key so forged ids are rejected without store lookup
+func shareSignature(key []byte, id string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("share-link:" + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:shareLinkSigLength])
+}
+
+func (sl *ShareLinks) token(id string) string {
+	return id + "." + shareSignature(sl.Keys[0], id)
+}
+
+// linkID verifies token signature and returns link id
+func (sl *ShareLinks) linkID(token string) (string, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || parts[0] == "" {
+		return "", false
+	}
+
+	for _, key := range sl.Keys {
+		if hmac.Equal([]byte(parts[1]), []byte(shareSignature(key, parts[0]))) {
+			return parts[0], true
+		}
+	}
+	return "", false
+}
+
+func newShareLinkID() (string, error) {
+	b := make([]byte, shareLinkIDLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("random: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type shareLinkResponse struct {
+	URL       string `json:"url"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// ShareLinkHandler creates share link for the storage file
+// form values: file, expires_in(seconds), max_downloads(zero means unlimited) and optional password
+func (h *Handler) ShareLinkHandler(w http.ResponseWriter, r *http.Request) {
+	if h.shareLinks == nil {
+		h.APIError(httperror.NewNotExistError("share links are disabled"), w, "ShareLinkHandler")
+		return
+	}
+
+	sp, err := h.requestParameters(r)
+	if err != nil {
+		h.APIError(httperror.NewInvalidParams("request parametes").WithError(err), w, "ShareLinkHandler")
+		return
+	}
+
+	if sp.IsPublic || h.publicStorages[sp.StorageName] {
+		h.APIError(httperror.NewInvalidParams("files of public storage are available without share links"), w, "ShareLinkHandler")
+		return
+	}
+
+	sp.FileName, err = sanitizeFileName(r.FormValue("file"))
+	if err != nil {
+		h.APIError(httperror.NewInvalidParams("invalid file name").WithError(err), w, "ShareLinkHandler")
+		return
+	}
+
+	expiresIn, err := strconv.ParseInt(r.FormValue("expires_in"), 10, 64)
+	if err != nil || expiresIn <= 0 || time.Duration(expiresIn)*time.Second > h.shareLinks.MaxTTL {
+		h.APIError(httperror.NewInvalidParams(fmt.Sprintf("expires_in should be from 1 to %d seconds", int64(h.shareLinks.MaxTTL/time.Second))), w, "ShareLinkHandler")
+		return
+	}
+
+	maxDownloads, err := strconv.Atoi(r.FormValue("max_downloads"))
+	if err != nil || maxDownloads < 0 || maxDownloads > maxShareDownloads {
+		h.APIError(httperror.NewInvalidParams(fmt.Sprintf("max_downloads should be from 0 to %d", maxShareDownloads)), w, "ShareLinkHandler")
+		return
+	}
+
+	password := r.FormValue("password")
+	if len(password) > maxSharePasswordSize {
+		h.APIError(httperror.NewInvalidParams(fmt.Sprintf("password should be at most %d bytes long", maxSharePasswordSize)), w, "ShareLinkHandler")
+		return
+	}
+
+	var passwordHash string
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			h.APIError(httperror.NewInternalError("hash password").WithError(err), w, "ShareLinkHandler")
+			return
+		}
+		passwordHash = string(hash)
+	}
+
+	id, err := newShareLinkID()
+	if err != nil {
+		h.APIError(httperror.NewInternalError("share link id").WithError(err), w, "ShareLinkHandler")
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(expiresIn) * time.Second)
+
+	values := sp.Values()
+	values.Add("scope", ScopeRead)
+	values.Add("expires_at", strconv.FormatInt(expiresAt.Unix(), 10))
+
+	gatewayToken, httpErr := h.gw.IssueToken(r.Context(), h.gatewayParams(r, w, sp.StorageName, values))
+	if httpErr != nil {
+		h.APIError(h.gatewayError(r, w, sp.StorageName, httpErr), w, "ShareLinkHandler")
+		return
+	}
+
+	err = h.shareLinks.Store.Save(ShareLink{
+		ID:           id,
+		Storage:      sp.StorageName,
+		File:         sp.FileName,
+		Permanent:    sp.IsPermanent,
+		MaxDownloads: maxDownloads,
+		PasswordHash: passwordHash,
+		GatewayToken: gatewayToken,
+		CreatedAt:    now,
+		ExpiresAt:    expiresAt,
+	})
+	if err != nil {
+		h.APIError(httperror.NewInternalError("save share link").WithError(err), w, "ShareLinkHandler")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, shareLinkResponse{
+		URL:       shareLinkPath + h.shareLinks.token(id) + "/",
+		ExpiresAt: expiresAt.Unix(),
+	})
+}
+
+// SharedFileHandler shows share link page on GET and streams the file on POST
+// download is not started by GET so link previews do not consume one time links
+func (h *Handler) SharedFileHandler(w http.ResponseWriter, r *http.Request) {
+	shareInfo := template.NewTemplateShare(Title)
+	renderTemplate := true
+	status := http.StatusOK
+	defer func() {
+		if renderTemplate {
+			w.WriteHeader(status)
+			if err := shareInfo.Execute(w); err != nil {
+				h.logger.Error(err)
+			}
+		}
+	}()
+
+	if h.shareLinks == nil {
+		status = http.StatusNotFound
+		shareInfo.AddError("common", "Link not found")
+		return
+	}
+
+	id, ok := h.shareLinks.linkID(strings.Trim(strings.TrimPrefix(r.URL.Path, shareLinkPath), "/"))
+	if !ok {
+		status = http.StatusNotFound
+		shareInfo.AddError("common", "Link not found")
+		return
+	}
+
+	link, ok, err := h.shareLinks.Store.Get(id)
+	if err != nil {
+		renderTemplate = false
+		h.Error(httperror.NewInternalError("share store").WithError(err), w, "SharedFileHandler")
+		return
+	}
+
+	if !ok || link.File == "" || !link.Available(time.Now()) {
+		status = http.StatusGone
+		shareInfo.AddError("common", "Link has expired or reached its download limit")
+		return
+	}
+
+	shareInfo.FileName = link.File
+	shareInfo.ExpiresAt = link.ExpiresAt.Unix()
+	shareInfo.NeedPassword = link.PasswordHash != ""
+	if link.MaxDownloads > 0 {
+		shareInfo.DownloadsLeft = link.MaxDownloads - link.Downloads
+	}
+
+	if r.Method != http.MethodPost {
+		return
+	}
+
+	if shareInfo.NeedPassword {
+		ip := h.clientIP(r)
+		limiterKey := "share:" + link.ID
+		if httpErr := h.loginLimiter.Allow(ip, limiterKey); httpErr != nil {
+			status = http.StatusTooManyRequests
+			setRetryAfter(w, httpErr)
+			shareInfo.AddError("password", "Too many attempts, please try again in %d seconds", retryAfterSeconds(httpErr))
+			return
+		}
+
+		if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(r.FormValue("password"))) != nil {
+			h.loginLimiter.Failure(ip, limiterKey)
+			status = http.StatusUnauthorized
+			shareInfo.AddError("password", "Invalid password")
+			return
+		}
+
+		h.loginLimiter.Success(ip, limiterKey)
+	}
+
+	sp := storageParameters{
+		StorageName: link.Storage,
+		IsPermanent: link.Permanent,
+		FileName:    link.File,
+	}
+
+	rsp, httpErr := h.gw.File(r.Context(), gateway.Params{Token: link.GatewayToken, Values: sp.Values()})
+	if httpErr != nil {
+		renderTemplate = false
+		h.Error(httpErr, w, "SharedFileHandler")
+		return
+	}
+	defer rsp.Body.Close()
+
+	// download is counted once the gateway returns the file so failed requests do not use the link up
+	// it is still counted before streaming so concurrent requests cannot exceed the limit
+	if _, err := h.shareLinks.Store.Use(link.ID, time.Now()); errors.Is(err, ErrShareLinkGone) {
+		status = http.StatusGone
+		shareInfo.AddError("common", "Link has expired or reached its download limit")
+		return
+	} else if err != nil {
+		renderTemplate = false
+		h.Error(httperror.NewInternalError("share store").WithError(err), w, "SharedFileHandler")
+		return
+	}
+
+	renderTemplate = false
+
+	w.Header().Set("Content-Type", attachmentContentType(fileContentType(link.File, func() []byte { return nil })))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", link.File))
+	w.Header().Set("Cache-Control", "no-store")
+	if rsp.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(rsp.ContentLength, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, rsp.Body); err != nil {
+		h.logger.WithError(err).
+			WithField("handler", "SharedFileHandler").
+			Error("failed to transfer bytes")
+	}
+}
+
+// deleteShareLinks removes all links of the deleted storage
+func (h *Handler) deleteShareLinks(storageName string) {
+	if h.shareLinks == nil {
+		return
+	}
+
+	if err := h.shareLinks.Store.DeleteStorage(storageName); err != nil {
+		h.logger.WithError(err).
+			WithField("storage", storageName).
+			Error("unable to delete share links")
+	}
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+// fakeShareStore keeps share links in memory
+type fakeShareStore struct {
+	mu    sync.Mutex
+	links map[string]ShareLink
+}
+
+func (s *fakeShareStore) Get(id string) (ShareLink, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.links[id]
+	return l, ok, nil
+}
+
+func (s *fakeShareStore) List(storage string) ([]ShareLink, error) {
+	return nil, nil
+}
+
+func (s *fakeShareStore) Save(l ShareLink) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links[l.ID] = l
+	return nil
+}
+
+func (s *fakeShareStore) Use(id string, now time.Time) (ShareLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.links[id]
+	if !ok || !l.Available(now) {
+		return ShareLink{}, ErrShareLinkGone
+	}
+	l.Downloads++
+	s.links[id] = l
+	return l, nil
+}
+
+func (s *fakeShareStore) Delete(storage string, id string) error {
+	return nil
+}
+
+func (s *fakeShareStore) DeleteStorage(storage string) error {
+	return nil
+}
+
+// closeRecorder reports whether response body is closed
+type closeRecorder struct {
+	*strings.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestSharedFileHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		downloads     int
+		fileErr       *httperror.Error
+		wantStatus    int
+		wantBody      string
+		wantDownloads int
+	}{
+		{
+			name:          "download",
+			wantStatus:    http.StatusOK,
+			wantBody:      "content",
+			wantDownloads: 1,
+		},
+		{
+			name:          "gateway error does not use the link",
+			fileErr:       httperror.NewInternalError("gateway is unavailable"),
+			wantStatus:    http.StatusInternalServerError,
+			wantDownloads: 0,
+		},
+		{
+			name:          "missing file does not use the link",
+			fileErr:       httperror.NewNotExistError("file not found"),
+			wantStatus:    http.StatusNotFound,
+			wantDownloads: 0,
+		},
+		{
+			name:          "limit reached by concurrent download",
+			downloads:     1,
+			wantStatus:    http.StatusGone,
+			wantBody:      "Link has expired or reached its download limit",
+			wantDownloads: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeShareStore{links: make(map[string]ShareLink)}
+			link := ShareLink{
+				ID:           "link1",
+				Storage:      "s1",
+				File:         "a.txt",
+				MaxDownloads: 1,
+				GatewayToken: "gateway-token",
+				ExpiresAt:    time.Now().Add(time.Hour),
+			}
+			store.Save(link)
+
+			var body *closeRecorder
+			gw := &fakeGateway{
+				file: func(p gateway.Params) (*http.Response, *httperror.Error) {
+					if tt.fileErr != nil {
+						return nil, tt.fileErr
+					}
+					body = &closeRecorder{Reader: strings.NewReader("content")}
+					return &http.Response{StatusCode: http.StatusOK, ContentLength: 7, Body: body}, nil
+				},
+			}
+
+			shareLinks := &ShareLinks{Store: store, Keys: [][]byte{[]byte("0123456789abcdef0123456789abcdef")}}
+			h := New(gw, newFakeSession(), nopLogger{}, WithShareLinks(shareLinks))
+
+			// the link is used up by concurrent download while the gateway serves this one
+			if tt.downloads > 0 {
+				file := gw.file
+				gw.file = func(p gateway.Params) (*http.Response, *httperror.Error) {
+					l, _, _ := store.Get(link.ID)
+					l.Downloads = tt.downloads
+					store.Save(l)
+					return file(p)
+				}
+			}
+
+			w := httptest.NewRecorder()
+			h.SharedFileHandler(w, httptest.NewRequest(http.MethodPost, shareLinkPath+shareLinks.token(link.ID)+"/", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if tt.wantBody != "" {
+				data, _ := ioutil.ReadAll(w.Body)
+				if !strings.Contains(string(data), tt.wantBody) {
+					t.Errorf("body does not contain %q", tt.wantBody)
+				}
+			}
+
+			if l, _, _ := store.Get(link.ID); l.Downloads != tt.wantDownloads {
+				t.Errorf("downloads = %d, want %d", l.Downloads, tt.wantDownloads)
+			}
+
+			if body != nil && !body.closed {
+				t.Error("gateway response body is not closed")
+			}
+		})
+	}
+}
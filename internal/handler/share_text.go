@@ -27,12 +27,10 @@ func (h *Handler) ShareTextHandler(w http.ResponseWriter, r *http.Request) {
 	values.Add("title", title)
 	values.Add("body", body)
 
-	rsp, httpErr := h.makePostRequest(r, w, sp.StorageName, "shareText", values)
-	if httpErr != nil {
-		h.Error(httpErr, w, "ShareTextHandler")
+	if httpErr := h.gw.ShareText(r.Context(), h.gatewayParams(r, w, sp.StorageName, values)); httpErr != nil {
+		h.Error(h.gatewayError(r, w, sp.StorageName, httpErr), w, "ShareTextHandler")
 		return
 	}
 
-	defer rsp.Body.Close()
 	w.WriteHeader(http.StatusOK)
 }
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+// errorStatus maps error to the http status code
+func errorStatus(err *httperror.Error) int {
+	var openErr *gateway.CircuitOpenError
+	if errors.As(err, &openErr) {
+		return http.StatusServiceUnavailable
+	}
+
+	var lockoutErr *LockoutError
+	if errors.As(err, &lockoutErr) {
+		return http.StatusTooManyRequests
+	}
+
+	var csrfErr *CSRFError
+	if errors.As(err, &csrfErr) {
+		return http.StatusForbidden
+	}
+
+	var scopeErr *ScopeError
+	if errors.As(err, &scopeErr) {
+		return http.StatusForbidden
+	}
+
+	var gwErr *gateway.Error
+	if errors.As(err, &gwErr) {
+		return gwErr.HTTPStatus()
+	}
+
+	return codeStatus(err.Code)
+}
+
+func codeStatus(code httperror.Code) int {
+	switch code {
+	case httperror.CodeInvalidParams:
+		return http.StatusUnprocessableEntity
+	case httperror.CodeUnauthorized, httperror.CodeNotMatch:
+		return http.StatusUnauthorized
+	case httperror.CodeNotExist:
+		return http.StatusNotFound
+	case httperror.CodeAlreadyExist:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *httperror.Error
+		want int
+	}{
+		{name: "invalid params", err: httperror.NewInvalidParams("params"), want: http.StatusUnprocessableEntity},
+		{name: "unauthorized", err: httperror.NewUnauthorized("token"), want: http.StatusUnauthorized},
+		{name: "not match", err: httperror.NewNotMatchError("password"), want: http.StatusUnauthorized},
+		{name: "not exist", err: httperror.NewNotExistError("file"), want: http.StatusNotFound},
+		{name: "already exist", err: httperror.NewAlreadyExistError("storage"), want: http.StatusConflict},
+		{name: "internal", err: httperror.NewInternalError("internal"), want: http.StatusInternalServerError},
+		{
+			name: "circuit open",
+			err:  httperror.NewInternalError("list").WithError(&gateway.CircuitOpenError{}),
+			want: http.StatusServiceUnavailable,
+		},
+		{
+			name: "lockout",
+			err:  httperror.NewUnauthorized("login").WithError(&LockoutError{}),
+			want: http.StatusTooManyRequests,
+		},
+		{
+			name: "csrf",
+			err:  httperror.NewInvalidParams("csrf").WithError(&CSRFError{Err: errors.New("mismatch")}),
+			want: http.StatusForbidden,
+		},
+		{
+			name: "scope",
+			err:  httperror.NewUnauthorized("scope").WithError(&ScopeError{Scope: "write"}),
+			want: http.StatusForbidden,
+		},
+		{
+			name: "gateway failure",
+			err:  httperror.NewInternalError("list").WithError(&gateway.Error{Status: http.StatusInternalServerError}),
+			want: http.StatusBadGateway,
+		},
+		{
+			name: "gateway timeout",
+			err:  httperror.NewInternalError("list").WithError(&gateway.Error{Err: context.DeadlineExceeded}),
+			want: http.StatusGatewayTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorStatus(tt.err); got != tt.want {
+				t.Fatalf("errorStatus = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
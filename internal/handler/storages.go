@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/template"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+// StoragesHandler shows all storages signed in from the current browser
+func (h *Handler) StoragesHandler(w http.ResponseWriter, r *http.Request) {
+	names := h.session.Storages(r)
+	sort.Strings(names)
+
+	storagesTemplate := template.NewTemplateStorages(Title, names)
+	storagesTemplate.CSRFToken = csrfToken(r)
+	_, storagesTemplate.CanRevoke = h.session.(Revoker)
+	if err := storagesTemplate.Execute(w); err != nil {
+		h.Error(httperror.NewInternalError("storages error").WithError(err), w, "StoragesHandler")
+		return
+	}
+}
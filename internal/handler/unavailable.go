@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing-web-service/internal/template"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+const (
+	defaultRetryAfter = 30 * time.Second
+)
+
+// UnavailableError indicates that browser should get service unavailable page instead of json error
+type UnavailableError struct {
+	cause *httperror.Error
+}
+
+func (e *UnavailableError) Error() string {
+	return e.cause.Error()
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.cause
+}
+
+// isGatewayUnavailable reports whether error was caused by gateway outage
+func isGatewayUnavailable(err error) bool {
+	var (
+		openErr *gateway.CircuitOpenError
+		gwErr   *gateway.Error
+	)
+	return errors.As(err, &openErr) || errors.As(err, &gwErr)
+}
+
+// retryAfter returns time after which gateway is expected to be available again
+// or login attempts are allowed again
+func retryAfter(err error) time.Duration {
+	var openErr *gateway.CircuitOpenError
+	if errors.As(err, &openErr) && openErr.RetryAfter > 0 {
+		return openErr.RetryAfter
+	}
+
+	var lockoutErr *LockoutError
+	if errors.As(err, &lockoutErr) && lockoutErr.RetryAfter > 0 {
+		return lockoutErr.RetryAfter
+	}
+	return defaultRetryAfter
+}
+
+func retryAfterSeconds(err error) int {
+	return int((retryAfter(err) + time.Second - 1) / time.Second)
+}
+
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var lockoutErr *LockoutError
+	if !isGatewayUnavailable(err) && !errors.As(err, &lockoutErr) {
+		return
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(err)))
+}
+
+func (h *Handler) renderUnavailable(w http.ResponseWriter, err *httperror.Error) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+
+	unavailableTemplate := template.NewTemplateUnavailable(Title, retryAfterSeconds(err))
+	if err := unavailableTemplate.Execute(w); err != nil {
+		h.logger.WithError(err).Error("unable to render unavailable page")
+	}
+}
+
+type listCacheItem struct {
+	files     []File
+	expiresAt time.Time
+}
+
+// listCache keeps last successful file lists for read only browsing while gateway is down
+type listCache struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	items map[string]listCacheItem
+}
+
+func newListCache(ttl time.Duration) *listCache {
+	return &listCache{
+		ttl:   ttl,
+		items: make(map[string]listCacheItem),
+	}
+}
+
+func (c *listCache) Get(key string) ([]File, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(item.expiresAt) {
+		delete(c.items, key)
+		return nil, false
+	}
+
+	return item.files, true
+}
+
+func (c *listCache) Set(key string, files []File) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, item := range c.items {
+		if now.After(item.expiresAt) {
+			delete(c.items, k)
+		}
+	}
+
+	c.items[key] = listCacheItem{
+		files:     files,
+		expiresAt: now.Add(c.ttl),
+	}
+}
@@ -14,12 +14,16 @@ func (h *Handler) UploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rsp, httpErr := h.makeMultipartRequest(r, w, sp.StorageName, "upload")
-	if httpErr != nil {
-		h.Error(httpErr, w, "GetFileHandler")
+	body, contentType, errCh, err := h.multipartBody(r)
+	if err != nil {
+		h.Error(httperror.NewInvalidParams("make body").WithError(err), w, "UploadHandler")
+		return
+	}
+
+	if httpErr := h.uploadStream(r, w, sp, body, contentType, errCh); httpErr != nil {
+		h.Error(httpErr, w, "UploadHandler")
 		return
 	}
 
-	defer rsp.Body.Close()
 	w.WriteHeader(http.StatusOK)
 }
@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+func multipartRequest(t *testing.T, files map[string]string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.WriteField("comment", "not a file"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		fw, err := mw.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(fw, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/s1/upload/", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+// readUpload decodes multipart body received by the gateway
+func readUpload(body io.Reader, contentType string) (map[string]string, error) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string)
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		data, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		files[part.FileName()] = string(data)
+	}
+}
+
+func TestUploadHandler(t *testing.T) {
+	var received map[string]string
+	gw := &fakeGateway{
+		upload: func(p gateway.Params, body io.Reader, contentType string) *httperror.Error {
+			files, err := readUpload(body, contentType)
+			if err != nil {
+				return httperror.NewInternalError("read upload").WithError(err)
+			}
+			received = files
+			return nil
+		},
+	}
+	session := newFakeSession()
+	session.tokens["s1"] = &Token{Value: "token"}
+	h := New(gw, session, nopLogger{})
+
+	files := map[string]string{"a.txt": "first", "b.txt": "second"}
+	w := httptest.NewRecorder()
+	h.UploadHandler(w, withRouterParameters(multipartRequest(t, files), "s1", true, ""))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	if len(received) != len(files) {
+		t.Fatalf("gateway received %v, want %v", received, files)
+	}
+	for name, content := range files {
+		if received[name] != content {
+			t.Errorf("file %s = %q, want %q", name, received[name], content)
+		}
+	}
+
+	p := gw.params[0]
+	if p.Token != "token" || p.Values.Get("storage") != "s1" || p.Values.Get("permanent") != "true" {
+		t.Errorf("gateway params token = %q values = %v", p.Token, p.Values)
+	}
+}
+
+func TestUploadHandlerErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		request    func(t *testing.T) *http.Request
+		upload     func(p gateway.Params, body io.Reader, contentType string) *httperror.Error
+		wantStatus int
+	}{
+		{
+			name: "not multipart",
+			request: func(t *testing.T) *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/s1/upload/", bytes.NewBufferString("data"))
+				r.Header.Set("Content-Type", "text/plain")
+				return r
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "file already exists",
+			request: func(t *testing.T) *http.Request {
+				return multipartRequest(t, map[string]string{"a.txt": "data"})
+			},
+			upload: func(p gateway.Params, body io.Reader, contentType string) *httperror.Error {
+				io.Copy(ioutil.Discard, body)
+				return httperror.NewAlreadyExistError("file already exists")
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "gateway stops reading",
+			request: func(t *testing.T) *http.Request {
+				return multipartRequest(t, map[string]string{"a.txt": "data"})
+			},
+			upload: func(p gateway.Params, body io.Reader, contentType string) *httperror.Error {
+				return httperror.NewInternalError("storage is full")
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &fakeGateway{upload: tt.upload}
+			session := newFakeSession()
+			session.tokens["s1"] = &Token{Value: "token"}
+			h := New(gw, session, nopLogger{})
+
+			w := httptest.NewRecorder()
+			h.UploadHandler(w, withRouterParameters(tt.request(t), "s1", false, ""))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUploadHandlerClientStalls(t *testing.T) {
+	gw := &fakeGateway{
+		upload: func(p gateway.Params, body io.Reader, contentType string) *httperror.Error {
+			return httperror.NewUnauthorized("token is expired")
+		},
+	}
+	h := New(gw, newFakeSession(), nopLogger{})
+
+	// client sends the headers and never the body
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodPost, "/s1/upload/", pr).WithContext(ctx)
+	r.Header.Set("Content-Type", "multipart/form-data; boundary=stalled")
+	r = withRouterParameters(r, "s1", false, "")
+
+	done := make(chan struct{})
+	go func() {
+		h.UploadHandler(httptest.NewRecorder(), r)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("handler returned before the request is canceled")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("handler hangs after the request is canceled")
+	}
+}
@@ -1,7 +1,7 @@
 package handler
 
 import (
-	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/Mikhalevich/filesharing-web-service/internal/template"
@@ -16,23 +16,24 @@ func (h *Handler) ViewHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fileResp, httpErr := h.makeGetRequest(r, w, sp.StorageName, "list", sp.Values())
-	if httpErr != nil {
-		h.Error(httpErr, w, "ViewHandler")
-		return
-	}
-	defer fileResp.Body.Close()
+	cacheKey := listCacheKey(sp, h.sessionToken(r, sp.StorageName))
+	readOnly := false
 
-	type fileList struct {
-		Name    string `json:"name"`
-		Size    int64  `json:"size"`
-		ModTime int64  `json:"mod_time"`
-	}
+	files, httpErr := h.listFiles(r, w, sp)
+	if httpErr != nil {
+		cached, ok := h.listCache.Get(cacheKey)
+		if !ok || !isGatewayUnavailable(httpErr) {
+			h.Error(httpErr, w, "ViewHandler")
+			return
+		}
 
-	var files []fileList
-	if err := json.NewDecoder(fileResp.Body).Decode(&files); err != nil {
-		h.Error(httperror.NewInternalError("files json decode error").WithError(err), w, "ViewHandler")
-		return
+		h.logger.WithError(httpErr).
+			WithField("handler", "ViewHandler").
+			Warn("gateway unavailable, show cached files")
+		files = cached
+		readOnly = true
+	} else {
+		h.listCache.Set(cacheKey, files)
 	}
 
 	fileInfos := make([]template.FileInfo, 0, len(files))
@@ -46,9 +47,28 @@ func (h *Handler) ViewHandler(w http.ResponseWriter, r *http.Request) {
 
 	viewPermanentLink := !sp.IsPermanent && !sp.IsPublic
 	viewTemplate := template.NewTemplateView(Title, viewPermanentLink, fileInfos)
+	viewTemplate.ReadOnly = readOnly
+	viewTemplate.CSRFToken = csrfToken(r)
+	viewTemplate.StorageName = sp.StorageName
+	viewTemplate.CanManage = !sp.IsPublic && !h.publicStorages[sp.StorageName]
+	viewTemplate.CanShare = viewTemplate.CanManage && !readOnly && h.shareLinks != nil
 
 	if err := viewTemplate.Execute(w); err != nil {
 		h.Error(httperror.NewInternalError("view error").WithError(err), w, "ViewHandler")
 		return
 	}
 }
+
+// listCacheKey includes session token so cached list is shown to the same session only
+func listCacheKey(sp storageParameters, token string) string {
+	return fmt.Sprintf("%s:%t:%s", sp.StorageName, sp.IsPermanent, token)
+}
+
+func (h *Handler) listFiles(r *http.Request, w http.ResponseWriter, sp storageParameters) ([]File, *httperror.Error) {
+	files, httpErr := h.gw.List(r.Context(), h.gatewayParams(r, w, sp.StorageName, sp.Values()))
+	if httpErr != nil {
+		return nil, h.gatewayError(r, w, sp.StorageName, httpErr)
+	}
+
+	return files, nil
+}
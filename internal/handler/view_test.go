@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/gateway"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+func TestViewHandlerGatewayUnauthorized(t *testing.T) {
+	tests := []struct {
+		name         string
+		header       http.Header
+		wantStatus   int
+		wantLocation string
+	}{
+		{
+			name:         "browser is redirected to login",
+			wantStatus:   http.StatusFound,
+			wantLocation: "/login/s1/?next=%2Fs1%2F",
+		},
+		{
+			name:       "ajax gets json error",
+			header:     http.Header{"X-Requested-With": {"XMLHttpRequest"}},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &fakeGateway{
+				list: func(p gateway.Params) ([]gateway.File, *httperror.Error) {
+					return nil, httperror.NewUnauthorized("token is expired")
+				},
+			}
+			session := newFakeSession()
+			session.tokens["s1"] = &Token{Value: "stale"}
+			h := New(gw, session, nopLogger{})
+
+			r := httptest.NewRequest(http.MethodGet, "/s1/", nil)
+			for name, values := range tt.header {
+				r.Header[name] = values
+			}
+
+			w := httptest.NewRecorder()
+			h.ViewHandler(w, withRouterParameters(r, "s1", false, ""))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if loc := w.Header().Get("Location"); loc != tt.wantLocation {
+				t.Errorf("location = %q, want %q", loc, tt.wantLocation)
+			}
+
+			if gw.params[0].Token != "stale" {
+				t.Errorf("gateway token = %q, want session token", gw.params[0].Token)
+			}
+
+			if token := session.GetToken("s1", nil); token != nil {
+				t.Errorf("stale session token is kept: %+v", token)
+			}
+		})
+	}
+}
+
+func TestViewHandlerListsFiles(t *testing.T) {
+	gw := &fakeGateway{
+		list: func(p gateway.Params) ([]gateway.File, *httperror.Error) {
+			return []gateway.File{{Name: "report.pdf", Size: 10}}, nil
+		},
+	}
+	session := newFakeSession()
+	session.tokens["s1"] = &Token{Value: "token"}
+	h := New(gw, session, nopLogger{})
+
+	w := httptest.NewRecorder()
+	h.ViewHandler(w, withRouterParameters(httptest.NewRequest(http.MethodGet, "/s1/", nil), "s1", false, ""))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	if !strings.Contains(w.Body.String(), "report.pdf") {
+		t.Error("file is not listed")
+	}
+
+	if session.GetToken("s1", nil) == nil {
+		t.Error("session token is removed")
+	}
+}
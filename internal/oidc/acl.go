@@ -0,0 +1,74 @@
+package oidc
+
+import (
+	"strings"
+)
+
+// ACLRule grants access to the storage for listed identities
+type ACLRule struct {
+	Storage string
+	// Emails are compared case insensitively, only verified emails are accepted
+	Emails []string
+	Groups []string
+}
+
+// ACL maps identities from id token to storages
+type ACL struct {
+	groupsClaim string
+	rules       map[string][]ACLRule
+}
+
+// NewACL constructor for ACL
+// groupsClaim is the name of id token claim with user groups
+func NewACL(groupsClaim string, rules []ACLRule) *ACL {
+	acl := &ACL{
+		groupsClaim: groupsClaim,
+		rules:       make(map[string][]ACLRule),
+	}
+
+	for _, r := range rules {
+		acl.rules[r.Storage] = append(acl.rules[r.Storage], r)
+	}
+
+	return acl
+}
+
+// Allowed reports whether identity from claims has access to the storage
+func (a *ACL) Allowed(storage string, c *Claims) bool {
+	var groups []string
+	if a.groupsClaim != "" {
+		groups = c.StringsClaim(a.groupsClaim)
+	}
+
+	for _, r := range a.rules[storage] {
+		if c.Email != "" && c.EmailVerified && containsFold(r.Emails, c.Email) {
+			return true
+		}
+
+		for _, g := range groups {
+			if contains(r.Groups, g) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func containsFold(values []string, v string) bool {
+	for _, item := range values {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, v string) bool {
+	for _, item := range values {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
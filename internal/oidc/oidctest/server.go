@@ -0,0 +1,242 @@
+// Package oidctest provides stub OpenID Connect provider for tests
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	keyID = "test"
+)
+
+type authorization struct {
+	challenge   string
+	nonce       string
+	redirectURL string
+	claims      map[string]interface{}
+}
+
+// Server is identity provider issuing id tokens signed with the generated rsa key
+// authorization codes are one time and bound to the pkce challenge of the auth request
+type Server struct {
+	*httptest.Server
+	ClientID string
+
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+	// tokenError makes token endpoint reject every request with the oauth error code
+	tokenError string
+}
+
+// NewServer starts identity provider for the client
+func NewServer(clientID string) (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+
+	s := &Server{
+		ClientID: clientID,
+		key:      key,
+		codes:    make(map[string]authorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/jwks", s.jwks)
+	mux.HandleFunc("/token", s.token)
+	s.Server = httptest.NewServer(mux)
+
+	return s, nil
+}
+
+// FailToken makes token endpoint respond with the oauth error code, empty code restores normal behaviour
+func (s *Server) FailToken(code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenError = code
+}
+
+// Authorize emulates user approval of the authorization url
+// it returns code and state the browser passes to the callback, claims are added to the id token
+func (s *Server) Authorize(authURL string, claims map[string]interface{}) (string, string, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", fmt.Errorf("parse auth url: %w", err)
+	}
+
+	q := u.Query()
+	switch {
+	case q.Get("response_type") != "code":
+		return "", "", fmt.Errorf("unsupported response type %q", q.Get("response_type"))
+	case q.Get("client_id") != s.ClientID:
+		return "", "", fmt.Errorf("unknown client %q", q.Get("client_id"))
+	case q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		return "", "", errors.New("pkce challenge is required")
+	case q.Get("state") == "":
+		return "", "", errors.New("state is required")
+	}
+
+	code, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.codes[code] = authorization{
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		redirectURL: q.Get("redirect_uri"),
+		claims:      claims,
+	}
+
+	return code, q.Get("state"), nil
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kid": keyID,
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			},
+		},
+	})
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	tokenError := s.tokenError
+	code := r.PostFormValue("code")
+	a, ok := s.codes[code]
+	delete(s.codes, code)
+	s.mu.Unlock()
+
+	if tokenError != "" {
+		oauthError(w, tokenError, "token endpoint is configured to fail")
+		return
+	}
+
+	if r.PostFormValue("grant_type") != "authorization_code" {
+		oauthError(w, "unsupported_grant_type", r.PostFormValue("grant_type"))
+		return
+	}
+
+	if !ok || r.PostFormValue("client_id") != s.ClientID || r.PostFormValue("redirect_uri") != a.redirectURL {
+		oauthError(w, "invalid_grant", "unknown code")
+		return
+	}
+
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(verifier[:]) != a.challenge {
+		oauthError(w, "invalid_grant", "code verifier does not match challenge")
+		return
+	}
+
+	idToken, err := s.sign(a)
+	if err != nil {
+		oauthError(w, "server_error", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func (s *Server) sign(a authorization) (string, error) {
+	claims := map[string]interface{}{
+		"iss":   s.URL,
+		"aud":   s.ClientID,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": a.nonce,
+	}
+	for name, v := range a.claims {
+		claims[name] = v
+	}
+
+	header, err := encodeSegment(map[string]string{"alg": "RS256", "kid": keyID, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := encodeSegment(claims)
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256.Sum256([]byte(header + "." + payload))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("sign: %w", err)
+	}
+
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func encodeSegment(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("encode segment: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func oauthError(w http.ResponseWriter, code string, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("random: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
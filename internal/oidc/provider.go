@@ -0,0 +1,275 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	discoveryPath     = "/.well-known/openid-configuration"
+	jwksRefreshPeriod = 5 * time.Minute
+	maxResponseSize   = 1 << 20
+)
+
+var (
+	// ErrInvalidToken indicates that id token failed verification
+	ErrInvalidToken = errors.New("invalid id token")
+)
+
+// Config describes OpenID Connect client registration
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider implements authorization code flow with PKCE against OpenID Connect provider
+// provider metadata is discovered lazily so the service starts even if identity provider is down
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu          sync.Mutex
+	meta        *discovery
+	keys        map[string]interface{}
+	keysFetched time.Time
+}
+
+// NewProvider constructor for Provider
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email"}
+	}
+
+	// id token is issued for openid scope only
+	if !contains(cfg.Scopes, "openid") {
+		cfg.Scopes = append([]string{"openid"}, cfg.Scopes...)
+	}
+
+	return &Provider{
+		cfg:    cfg,
+		client: client,
+	}
+}
+
+// AuthRequest contains values which should be kept until callback
+type AuthRequest struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// NewAuthRequest generates state, nonce and pkce verifier
+func NewAuthRequest() (AuthRequest, error) {
+	var (
+		ar  AuthRequest
+		err error
+	)
+
+	if ar.State, err = randomString(); err != nil {
+		return AuthRequest{}, err
+	}
+
+	if ar.Nonce, err = randomString(); err != nil {
+		return AuthRequest{}, err
+	}
+
+	if ar.Verifier, err = randomString(); err != nil {
+		return AuthRequest{}, err
+	}
+
+	return ar, nil
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("random: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthURL returns identity provider url the browser should be redirected to
+func (p *Provider) AuthURL(ctx context.Context, ar AuthRequest) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(ar.Verifier))
+
+	values := url.Values{}
+	values.Set("response_type", "code")
+	values.Set("client_id", p.cfg.ClientID)
+	values.Set("redirect_uri", p.cfg.RedirectURL)
+	values.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	values.Set("state", ar.State)
+	values.Set("nonce", ar.Nonce)
+	values.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	values.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return meta.AuthorizationEndpoint + sep + values.Encode(), nil
+}
+
+// Exchange redeems authorization code and returns verified id token claims together with raw id token
+func (p *Provider) Exchange(ctx context.Context, code string, ar AuthRequest) (*Claims, string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	values := url.Values{}
+	values.Set("grant_type", "authorization_code")
+	values.Set("code", code)
+	values.Set("redirect_uri", p.cfg.RedirectURL)
+	values.Set("client_id", p.cfg.ClientID)
+	values.Set("code_verifier", ar.Verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, "", fmt.Errorf("token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var tokenRsp struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := p.doJSON(req, &tokenRsp); err != nil {
+		if tokenRsp.Error != "" {
+			return nil, "", fmt.Errorf("token endpoint: %s: %s", tokenRsp.Error, tokenRsp.ErrorDescription)
+		}
+		return nil, "", fmt.Errorf("token endpoint: %w", err)
+	}
+
+	if tokenRsp.IDToken == "" {
+		return nil, "", fmt.Errorf("%w: id_token is missing in token response", ErrInvalidToken)
+	}
+
+	claims, err := p.verify(ctx, meta, tokenRsp.IDToken, ar.Nonce)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return claims, tokenRsp.IDToken, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.cfg.Issuer, "/")+discoveryPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("discovery request: %w", err)
+	}
+
+	var meta discovery
+	if err := p.doJSON(req, &meta); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+
+	if strings.TrimSuffix(meta.Issuer, "/") != strings.TrimSuffix(p.cfg.Issuer, "/") {
+		return nil, fmt.Errorf("discovery: issuer mismatch %q", meta.Issuer)
+	}
+
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("discovery: incomplete provider metadata")
+	}
+
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// key returns verification key by id, keys are refetched on unknown key id not more often than jwksRefreshPeriod
+func (p *Provider) key(ctx context.Context, meta *discovery, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	if p.keys != nil && time.Since(p.keysFetched) < jwksRefreshPeriod {
+		return nil, fmt.Errorf("%w: unknown key id %q", ErrInvalidToken, kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.JWKSURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("jwks request: %w", err)
+	}
+
+	var set jwkSet
+	if err := p.doJSON(req, &set); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+
+	p.keys = set.publicKeys()
+	p.keysFetched = time.Now()
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key id %q", ErrInvalidToken, kid)
+	}
+	return key, nil
+}
+
+func (p *Provider) doJSON(req *http.Request, v interface{}) error {
+	rsp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(rsp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+
+	// error responses of token endpoint are json as well
+	jsonErr := json.Unmarshal(data, v)
+
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", rsp.StatusCode)
+	}
+
+	if jsonErr != nil {
+		return fmt.Errorf("decode response: %w", jsonErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/oidc/oidctest"
+)
+
+const (
+	testClientID    = "web"
+	testRedirectURL = "http://web.example/oidc/callback/"
+)
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Server) {
+	t.Helper()
+
+	idp, err := oidctest.NewServer(testClientID)
+	if err != nil {
+		t.Fatalf("start identity provider: %v", err)
+	}
+	t.Cleanup(idp.Close)
+
+	p := NewProvider(Config{
+		Issuer:      idp.URL,
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	}, idp.Client())
+
+	return p, idp
+}
+
+// authorize starts auth request and returns code issued by identity provider
+func authorize(t *testing.T, p *Provider, idp *oidctest.Server, claims map[string]interface{}) (AuthRequest, string) {
+	t.Helper()
+
+	ar, err := NewAuthRequest()
+	if err != nil {
+		t.Fatalf("auth request: %v", err)
+	}
+
+	authURL, err := p.AuthURL(context.Background(), ar)
+	if err != nil {
+		t.Fatalf("auth url: %v", err)
+	}
+
+	code, state, err := idp.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+
+	if state != ar.State {
+		t.Fatalf("state = %q, want %q", state, ar.State)
+	}
+
+	return ar, code
+}
+
+func TestProviderAuthURL(t *testing.T) {
+	p, idp := newTestProvider(t)
+
+	ar, err := NewAuthRequest()
+	if err != nil {
+		t.Fatalf("auth request: %v", err)
+	}
+
+	authURL, err := p.AuthURL(context.Background(), ar)
+	if err != nil {
+		t.Fatalf("auth url: %v", err)
+	}
+
+	if !strings.HasPrefix(authURL, idp.URL+"/authorize?") {
+		t.Fatalf("auth url %q does not point to authorization endpoint", authURL)
+	}
+
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	for name, want := range map[string]string{
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"state":                 ar.State,
+		"nonce":                 ar.Nonce,
+		"code_challenge_method": "S256",
+		"scope":                 "openid email",
+	} {
+		if got := q.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	if q.Get("code_challenge") == "" || q.Get("code_challenge") == ar.Verifier {
+		t.Errorf("code_challenge = %q, want hashed verifier", q.Get("code_challenge"))
+	}
+}
+
+func TestProviderExchange(t *testing.T) {
+	p, idp := newTestProvider(t)
+	ar, code := authorize(t, p, idp, map[string]interface{}{
+		"sub":            "user1",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"groups":         []string{"dev"},
+	})
+
+	claims, idToken, err := p.Exchange(context.Background(), code, ar)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+
+	if idToken == "" {
+		t.Fatal("id token is empty")
+	}
+
+	if claims.Subject != "user1" || claims.Email != "user@example.com" || !claims.EmailVerified {
+		t.Fatalf("claims = %+v", claims)
+	}
+
+	if groups := claims.StringsClaim("groups"); len(groups) != 1 || groups[0] != "dev" {
+		t.Fatalf("groups = %v", groups)
+	}
+
+	// code is redeemed once
+	if _, _, err := p.Exchange(context.Background(), code, ar); err == nil {
+		t.Fatal("code is accepted twice")
+	}
+}
+
+func TestProviderExchangeErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		prepare    func(ar *AuthRequest, idp *oidctest.Server)
+		wantErr    string
+		wantTarget error
+	}{
+		{
+			name: "wrong pkce verifier",
+			prepare: func(ar *AuthRequest, idp *oidctest.Server) {
+				ar.Verifier = "other"
+			},
+			wantErr: "invalid_grant",
+		},
+		{
+			name: "token endpoint error",
+			prepare: func(ar *AuthRequest, idp *oidctest.Server) {
+				idp.FailToken("access_denied")
+			},
+			wantErr: "access_denied",
+		},
+		{
+			name: "nonce mismatch",
+			prepare: func(ar *AuthRequest, idp *oidctest.Server) {
+				ar.Nonce = "other"
+			},
+			wantTarget: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, idp := newTestProvider(t)
+			ar, code := authorize(t, p, idp, map[string]interface{}{"sub": "user1"})
+			tt.prepare(&ar, idp)
+
+			_, _, err := p.Exchange(context.Background(), code, ar)
+			if err == nil {
+				t.Fatal("exchange succeeded")
+			}
+
+			if tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error %q does not contain %q", err, tt.wantErr)
+			}
+
+			if tt.wantTarget != nil && !errors.Is(err, tt.wantTarget) {
+				t.Fatalf("error %q is not %q", err, tt.wantTarget)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	clockSkew = time.Minute
+)
+
+// Claims contains verified id token claims used for access decisions
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	// Raw contains all token claims so groups could be read from provider specific claim
+	Raw map[string]interface{}
+}
+
+// StringsClaim returns claim value as list of strings, single string value is accepted as well
+func (c *Claims) StringsClaim(name string) []string {
+	switch v := c.Raw[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type tokenClaims struct {
+	Issuer        string      `json:"iss"`
+	Subject       string      `json:"sub"`
+	Audience      interface{} `json:"aud"`
+	ExpiresAt     int64       `json:"exp"`
+	NotBefore     int64       `json:"nbf"`
+	Nonce         string      `json:"nonce"`
+	Email         string      `json:"email"`
+	EmailVerified interface{} `json:"email_verified"`
+}
+
+func (tc tokenClaims) hasAudience(clientID string) bool {
+	switch aud := tc.Audience.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// emailVerified accepts both boolean and string values, some providers send "true"
+func (tc tokenClaims) emailVerified() bool {
+	switch v := tc.EmailVerified.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+func (p *Provider) verify(ctx context.Context, meta *discovery, rawToken string, nonce string) (*Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature encoding", ErrInvalidToken)
+	}
+
+	key, err := p.key(ctx, meta, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var tc tokenClaims
+	if err := decodeSegment(parts[1], &tc); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	switch {
+	case strings.TrimSuffix(tc.Issuer, "/") != strings.TrimSuffix(meta.Issuer, "/"):
+		return nil, fmt.Errorf("%w: issuer mismatch", ErrInvalidToken)
+	case !tc.hasAudience(p.cfg.ClientID):
+		return nil, fmt.Errorf("%w: audience mismatch", ErrInvalidToken)
+	case tc.ExpiresAt == 0 || now.After(time.Unix(tc.ExpiresAt, 0).Add(clockSkew)):
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidToken)
+	case tc.NotBefore != 0 && now.Add(clockSkew).Before(time.Unix(tc.NotBefore, 0)):
+		return nil, fmt.Errorf("%w: token is not valid yet", ErrInvalidToken)
+	case tc.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+
+	raw := make(map[string]interface{})
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return nil, err
+	}
+
+	return &Claims{
+		Subject:       tc.Subject,
+		Email:         tc.Email,
+		EmailVerified: tc.emailVerified(),
+		Raw:           raw,
+	}, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: segment encoding", ErrInvalidToken)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: segment json", ErrInvalidToken)
+	}
+	return nil
+}
+
+func verifySignature(alg string, key interface{}, signed []byte, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		// none and hmac algorithms are never accepted
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, alg)
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("%w: algorithm does not match key", ErrInvalidToken)
+		}
+
+		if err := rsa.VerifyPKCS1v15(k, hash, digest, signature); err != nil {
+			return fmt.Errorf("%w: signature", ErrInvalidToken)
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			return fmt.Errorf("%w: algorithm does not match key", ErrInvalidToken)
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return fmt.Errorf("%w: signature", ErrInvalidToken)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%w: unsupported key type", ErrInvalidToken)
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// publicKeys converts signing keys of the set, unsupported keys are skipped
+func (s jwkSet) publicKeys() map[string]interface{} {
+	keys := make(map[string]interface{}, len(s.Keys))
+	for _, k := range s.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil || len(e) > 4 {
+				continue
+			}
+
+			keys[k.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			curve := ellipticCurve(k.Crv)
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if curve == nil || errX != nil || errY != nil {
+				continue
+			}
+
+			pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+			if !curve.IsOnCurve(pub.X, pub.Y) {
+				continue
+			}
+			keys[k.Kid] = pub
+		}
+	}
+	return keys
+}
+
+func ellipticCurve(name string) elliptic.Curve {
+	switch name {
+	case "P-256":
+		return elliptic.P256()
+	case "P-384":
+		return elliptic.P384()
+	case "P-521":
+		return elliptic.P521()
+	}
+	return nil
+}
@@ -16,18 +16,49 @@ type route struct {
 	Methods       string
 	Public        bool
 	PermanentPath bool
+	CSRFExempt    bool
+	Scope         string // personal api token scope, empty means the tokens are not accepted
+	SessionOnly   bool   // bearer tokens are rejected, handler does not verify them with the gateway
 	Handler       http.Handler
 }
 
 type handler interface {
 	RegisterHandler(w http.ResponseWriter, r *http.Request)
 	LoginHandler(w http.ResponseWriter, r *http.Request)
+	LogoutHandler(w http.ResponseWriter, r *http.Request)
+	StoragesHandler(w http.ResponseWriter, r *http.Request)
+	ChangePasswordHandler(w http.ResponseWriter, r *http.Request)
+	DeleteStorageHandler(w http.ResponseWriter, r *http.Request)
 	IndexHTMLHandler(w http.ResponseWriter, r *http.Request)
 	ViewHandler(w http.ResponseWriter, r *http.Request)
 	UploadHandler(w http.ResponseWriter, r *http.Request)
 	RemoveHandler(w http.ResponseWriter, r *http.Request)
+	MoveToPermanentHandler(w http.ResponseWriter, r *http.Request)
 	GetFileHandler(w http.ResponseWriter, r *http.Request)
 	ShareTextHandler(w http.ResponseWriter, r *http.Request)
+	ArchiveHandler(w http.ResponseWriter, r *http.Request)
+	APIListHandler(w http.ResponseWriter, r *http.Request)
+	APIUploadHandler(w http.ResponseWriter, r *http.Request)
+	APIRemoveHandler(w http.ResponseWriter, r *http.Request)
+	APIShareTextHandler(w http.ResponseWriter, r *http.Request)
+	APILoginHandler(w http.ResponseWriter, r *http.Request)
+	APIRegisterHandler(w http.ResponseWriter, r *http.Request)
+	AdminRevokeHandler(w http.ResponseWriter, r *http.Request)
+	APITokensHandler(w http.ResponseWriter, r *http.Request)
+	RevokeAPITokenHandler(w http.ResponseWriter, r *http.Request)
+	ShareLinkHandler(w http.ResponseWriter, r *http.Request)
+	SharedFileHandler(w http.ResponseWriter, r *http.Request)
+	PublicPagesHandler(w http.ResponseWriter, r *http.Request)
+	RevokePublicPageHandler(w http.ResponseWriter, r *http.Request)
+	PublicViewHandler(w http.ResponseWriter, r *http.Request)
+	PublicFileHandler(w http.ResponseWriter, r *http.Request)
+	PublicArchiveHandler(w http.ResponseWriter, r *http.Request)
+	OIDCLoginHandler(w http.ResponseWriter, r *http.Request)
+	OIDCCallbackHandler(w http.ResponseWriter, r *http.Request)
+	CheckAuthMiddleware(next http.Handler) http.Handler
+	TokenScopeMiddleware(scope string, next http.Handler) http.Handler
+	CSRFMiddleware(next http.Handler) http.Handler
+	SessionOnlyMiddleware(next http.Handler) http.Handler
 	RecoverMiddleware(next http.Handler) http.Handler
 }
 
@@ -71,6 +102,187 @@ func configure(h handler) []route {
 			Public:  true,
 			Handler: http.HandlerFunc(h.LoginHandler),
 		},
+		{
+			Pattern: "/logout/",
+			Methods: "POST",
+			Public:  true,
+			Handler: http.HandlerFunc(h.LogoutHandler),
+		},
+		{
+			Pattern: "/logout/{storage}/",
+			Methods: "POST",
+			Public:  true,
+			Handler: http.HandlerFunc(h.LogoutHandler),
+		},
+		{
+			Pattern: "/oidc/login/{storage}/",
+			Methods: "GET",
+			Public:  true,
+			Handler: http.HandlerFunc(h.OIDCLoginHandler),
+		},
+		{
+			Pattern: "/oidc/callback/",
+			Methods: "GET",
+			Public:  true,
+			Handler: http.HandlerFunc(h.OIDCCallbackHandler),
+		},
+		{
+			// share link page has no session authority, password form does not need csrf protection
+			Pattern:    "/s/{token}/",
+			Methods:    "GET,POST",
+			Public:     true,
+			CSRFExempt: true,
+			Handler:    http.HandlerFunc(h.SharedFileHandler),
+		},
+		{
+			// viewer password form has no session authority as well
+			Pattern:    "/p/{token}/",
+			Methods:    "GET,POST",
+			Public:     true,
+			CSRFExempt: true,
+			Handler:    http.HandlerFunc(h.PublicViewHandler),
+		},
+		{
+			// archive is post only so it does not shadow the file named archive
+			Pattern:    "/p/{token}/archive/",
+			Methods:    "POST",
+			Public:     true,
+			CSRFExempt: true,
+			Handler:    http.HandlerFunc(h.PublicArchiveHandler),
+		},
+		{
+			Pattern: "/p/{token}/{file}/",
+			Methods: "GET",
+			Public:  true,
+			Handler: http.HandlerFunc(h.PublicFileHandler),
+		},
+		{
+			Pattern: "/storages/",
+			Methods: "GET",
+			Public:  true,
+			Handler: http.HandlerFunc(h.StoragesHandler),
+		},
+		{
+			Pattern:     "/settings/{storage}/password/",
+			Methods:     "GET,POST",
+			SessionOnly: true,
+			Handler:     http.HandlerFunc(h.ChangePasswordHandler),
+		},
+		{
+			Pattern:     "/settings/{storage}/delete/",
+			Methods:     "GET,POST",
+			SessionOnly: true,
+			Handler:     http.HandlerFunc(h.DeleteStorageHandler),
+		},
+		{
+			Pattern:     "/settings/{storage}/tokens/",
+			Methods:     "GET,POST",
+			SessionOnly: true,
+			Handler:     http.HandlerFunc(h.APITokensHandler),
+		},
+		{
+			Pattern:     "/settings/{storage}/tokens/revoke/",
+			Methods:     "POST",
+			SessionOnly: true,
+			Handler:     http.HandlerFunc(h.RevokeAPITokenHandler),
+		},
+		{
+			Pattern:     "/settings/{storage}/public/",
+			Methods:     "GET,POST",
+			SessionOnly: true,
+			Handler:     http.HandlerFunc(h.PublicPagesHandler),
+		},
+		{
+			Pattern:     "/settings/{storage}/public/revoke/",
+			Methods:     "POST",
+			SessionOnly: true,
+			Handler:     http.HandlerFunc(h.RevokePublicPageHandler),
+		},
+		{
+			Pattern:    "/api/v1/storages/",
+			Methods:    "POST",
+			Public:     true,
+			CSRFExempt: true,
+			Handler:    http.HandlerFunc(h.APIRegisterHandler),
+		},
+		{
+			Pattern:    "/api/v1/storages/{storage}/login/",
+			Methods:    "POST",
+			Public:     true,
+			CSRFExempt: true,
+			Handler:    http.HandlerFunc(h.APILoginHandler),
+		},
+		{
+			Pattern: "/api/v1/admin/storages/{storage}/sessions/",
+			Methods: "DELETE",
+			Public:  true,
+			Handler: http.HandlerFunc(h.AdminRevokeHandler),
+		},
+		{
+			Pattern: "/api/v1/storages/{storage}/files/",
+			Methods: "GET",
+			Scope:   "read",
+			Handler: http.HandlerFunc(h.APIListHandler),
+		},
+		{
+			Pattern:       "/api/v1/storages/{storage}/permanent/files/",
+			Methods:       "GET",
+			PermanentPath: true,
+			Scope:         "read",
+			Handler:       http.HandlerFunc(h.APIListHandler),
+		},
+		{
+			Pattern: "/api/v1/storages/{storage}/files/{file}/",
+			Methods: "GET",
+			Scope:   "read",
+			Handler: http.HandlerFunc(h.GetFileHandler),
+		},
+		{
+			Pattern:       "/api/v1/storages/{storage}/permanent/files/{file}/",
+			Methods:       "GET",
+			PermanentPath: true,
+			Scope:         "read",
+			Handler:       http.HandlerFunc(h.GetFileHandler),
+		},
+		{
+			Pattern: "/api/v1/storages/{storage}/files/{file}/",
+			Methods: "PUT",
+			Scope:   "upload",
+			Handler: http.HandlerFunc(h.APIUploadHandler),
+		},
+		{
+			Pattern:       "/api/v1/storages/{storage}/permanent/files/{file}/",
+			Methods:       "PUT",
+			PermanentPath: true,
+			Scope:         "upload",
+			Handler:       http.HandlerFunc(h.APIUploadHandler),
+		},
+		{
+			Pattern: "/api/v1/storages/{storage}/files/{file}/",
+			Methods: "DELETE",
+			Scope:   "delete",
+			Handler: http.HandlerFunc(h.APIRemoveHandler),
+		},
+		{
+			Pattern:       "/api/v1/storages/{storage}/permanent/files/{file}/",
+			Methods:       "DELETE",
+			PermanentPath: true,
+			Scope:         "delete",
+			Handler:       http.HandlerFunc(h.APIRemoveHandler),
+		},
+		{
+			Pattern: "/api/v1/storages/{storage}/texts/",
+			Methods: "POST",
+			Scope:   "upload",
+			Handler: http.HandlerFunc(h.APIShareTextHandler),
+		},
+		{
+			Pattern:       "/api/v1/storages/{storage}/permanent/texts/",
+			Methods:       "POST",
+			PermanentPath: true,
+			Scope:         "upload",
+			Handler:       http.HandlerFunc(h.APIShareTextHandler),
+		},
 		{
 			Pattern: "/{storage}/index.html",
 			Methods: "GET",
@@ -86,6 +298,7 @@ func configure(h handler) []route {
 			Pattern:       "/{storage}/permanent/{file}/",
 			Methods:       "GET",
 			PermanentPath: true,
+			Scope:         "read",
 			Handler:       http.HandlerFunc(h.GetFileHandler),
 		},
 		{
@@ -97,6 +310,7 @@ func configure(h handler) []route {
 		{
 			Pattern: "/{storage}/{file}/",
 			Methods: "GET",
+			Scope:   "read",
 			Handler: http.HandlerFunc(h.GetFileHandler),
 		},
 		{
@@ -107,34 +321,70 @@ func configure(h handler) []route {
 		{
 			Pattern: "/{storage}/upload/",
 			Methods: "POST",
+			Scope:   "upload",
 			Handler: http.HandlerFunc(h.UploadHandler),
 		},
 		{
 			Pattern:       "/{storage}/permanent/upload/",
 			Methods:       "POST",
 			PermanentPath: true,
+			Scope:         "upload",
 			Handler:       http.HandlerFunc(h.UploadHandler),
 		},
 		{
 			Pattern: "/{storage}/remove/",
 			Methods: "POST",
+			Scope:   "delete",
 			Handler: http.HandlerFunc(h.RemoveHandler),
 		},
 		{
 			Pattern:       "/{storage}/permanent/remove/",
 			Methods:       "POST",
 			PermanentPath: true,
+			Scope:         "delete",
 			Handler:       http.HandlerFunc(h.RemoveHandler),
 		},
+		{
+			// move needs both upload and delete, personal api tokens are not accepted
+			Pattern: "/{storage}/move/",
+			Methods: "POST",
+			Handler: http.HandlerFunc(h.MoveToPermanentHandler),
+		},
+		{
+			Pattern: "/{storage}/share/",
+			Methods: "POST",
+			Handler: http.HandlerFunc(h.ShareLinkHandler),
+		},
+		{
+			Pattern:       "/{storage}/permanent/share/",
+			Methods:       "POST",
+			PermanentPath: true,
+			Handler:       http.HandlerFunc(h.ShareLinkHandler),
+		},
+		{
+			Pattern: "/{storage}/archive/",
+			Methods: "POST",
+			Scope:   "read",
+			Handler: http.HandlerFunc(h.ArchiveHandler),
+		},
+		{
+			Pattern:       "/{storage}/permanent/archive/",
+			Methods:       "POST",
+			PermanentPath: true,
+			Scope:         "read",
+			Handler:       http.HandlerFunc(h.ArchiveHandler),
+		},
 		{
 			Pattern: "/{storage}/shareText/",
 			Methods: "POST",
+			Scope:   "upload",
 			Handler: http.HandlerFunc(h.ShareTextHandler),
 		},
 		{
 			Pattern:       "/{storage}/permanent/shareText/",
 			Methods:       "POST",
 			PermanentPath: true,
+			Scope:         "upload",
 			Handler:       http.HandlerFunc(h.ShareTextHandler),
 		},
 	}
@@ -173,10 +423,24 @@ func MakeRoutes(router *mux.Router, authEnabled bool, h handler, l Logger) {
 
 		handler := route.Handler
 		if authEnabled && !route.Public {
-			//handler = r.h.CheckAuthMiddleware(handler)
+			handler = h.CheckAuthMiddleware(handler)
+		}
+
+		if route.Scope != "" {
+			handler = h.TokenScopeMiddleware(route.Scope, handler)
 		}
 		handler = storeRouterParametes(route.Public, route.PermanentPath, handler)
 
+		// api login and register do not rely on cookies and return token in the body
+		if !route.CSRFExempt {
+			handler = h.CSRFMiddleware(handler)
+		}
+
+		// bearer request would skip csrf check, so it is rejected before
+		if route.SessionOnly {
+			handler = h.SessionOnlyMiddleware(handler)
+		}
+
 		handler = h.RecoverMiddleware(handler)
 
 		muxRoute.Handler(handler)
@@ -0,0 +1,92 @@
+package router_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/handler"
+	"github.com/Mikhalevich/filesharing-web-service/internal/router"
+	"github.com/Mikhalevich/filesharing-web-service/internal/wrapper"
+	"github.com/Mikhalevich/filesharing/pkg/service"
+	"github.com/gorilla/mux"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...interface{})            {}
+func (nopLogger) Infof(format string, args ...interface{})             {}
+func (nopLogger) Warnf(format string, args ...interface{})             {}
+func (nopLogger) Errorf(format string, args ...interface{})            {}
+func (nopLogger) Debug(args ...interface{})                            {}
+func (nopLogger) Info(args ...interface{})                             {}
+func (nopLogger) Warn(args ...interface{})                             {}
+func (nopLogger) Error(args ...interface{})                            {}
+func (l nopLogger) WithContext(ctx context.Context) service.Logger     { return l }
+func (l nopLogger) WithError(err error) service.Logger                 { return l }
+func (l nopLogger) WithField(key string, v interface{}) service.Logger { return l }
+func (l nopLogger) WithFields(map[string]interface{}) service.Logger   { return l }
+
+// newTestRouter makes routes without gateway, requests reaching the gateway panic and are recovered
+func newTestRouter(t *testing.T) *mux.Router {
+	t.Helper()
+
+	codec, err := wrapper.NewCookieCodec(bytes.Repeat([]byte{'k'}, wrapper.MinCookieKeyLength))
+	if err != nil {
+		t.Fatalf("cookie codec: %v", err)
+	}
+
+	session, err := wrapper.NewCookieSession(3600, codec)
+	if err != nil {
+		t.Fatalf("cookie session: %v", err)
+	}
+
+	h := handler.New(nil, session, nopLogger{})
+	r := mux.NewRouter()
+	router.MakeRoutes(r, true, h, nopLogger{})
+	return r
+}
+
+func TestSessionOnlyRoutesRejectBearer(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{method: http.MethodPost, path: "/settings/s1/password/"},
+		{method: http.MethodPost, path: "/settings/s1/delete/"},
+		{method: http.MethodGet, path: "/settings/s1/tokens/"},
+		{method: http.MethodPost, path: "/settings/s1/tokens/"},
+		{method: http.MethodPost, path: "/settings/s1/tokens/revoke/"},
+		{method: http.MethodGet, path: "/settings/s1/public/"},
+		{method: http.MethodPost, path: "/settings/s1/public/"},
+		{method: http.MethodPost, path: "/settings/s1/public/revoke/"},
+	}
+
+	routes := newTestRouter(t)
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("Authorization", "Bearer x")
+
+			w := httptest.NewRecorder()
+			routes.ServeHTTP(w, r)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestSessionOnlyRoutesRedirectWithoutSession(t *testing.T) {
+	routes := newTestRouter(t)
+
+	w := httptest.NewRecorder()
+	routes.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/settings/s1/tokens/", nil))
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"html/template"
 	"io"
 	"io/fs"
+	"time"
 )
 
 var (
@@ -15,7 +16,10 @@ var (
 	//go:embed res
 	resources embed.FS
 
-	funcs       = template.FuncMap{"increment": func(i int) int { i++; return i }}
+	funcs = template.FuncMap{
+		"increment": func(i int) int { i++; return i },
+		"date":      func(unix int64) string { return time.Unix(unix, 0).UTC().Format("2006-01-02 15:04 UTC") },
+	}
 	pcTemplates = template.Must(template.New("fileSharing").Funcs(funcs).ParseFS(content, "html/*.html"))
 )
 
@@ -24,8 +28,9 @@ func Resources() fs.FS {
 }
 
 type TemplateBase struct {
-	Name   string
-	Errors map[string]string
+	Name      string
+	CSRFToken string
+	Errors    map[string]string
 }
 
 func NewTemplateBase(name string) *TemplateBase {
@@ -46,6 +51,9 @@ func (t *TemplateBase) ExecuteTemplate(wr io.Writer, data interface{}) error {
 type TemplatePassword struct {
 	TemplateBase
 	Password string
+	Remember bool
+	// SSOURL is single sign on link, empty if sso is disabled
+	SSOURL string
 }
 
 func NewTemplatePassword() *TemplatePassword {
@@ -85,7 +93,13 @@ type TemplateView struct {
 	TemplateBase
 	Title             string
 	NeedPermanentLink bool
-	FileInfoList      []FileInfo
+	ReadOnly          bool
+	StorageName       string
+	CanManage         bool
+	CanShare          bool
+	// Viewer is set for public page visitors who can only browse and download files
+	Viewer       bool
+	FileInfoList []FileInfo
 }
 
 func NewTemplateView(title string, needPermanentLink bool, list []FileInfo) *TemplateView {
@@ -97,6 +111,170 @@ func NewTemplateView(title string, needPermanentLink bool, list []FileInfo) *Tem
 	}
 }
 
+// CanEdit reports whether upload, remove and text sharing controls are shown
+func (t TemplateView) CanEdit() bool {
+	return !t.ReadOnly && !t.Viewer
+}
+
 func (t *TemplateView) Execute(wr io.Writer) error {
 	return t.TemplateBase.ExecuteTemplate(wr, *t)
 }
+
+type TemplateStorages struct {
+	TemplateBase
+	Title     string
+	CanRevoke bool
+	Storages  []string
+}
+
+func NewTemplateStorages(title string, storages []string) *TemplateStorages {
+	return &TemplateStorages{
+		TemplateBase: *NewTemplateBase("storages.html"),
+		Title:        title,
+		Storages:     storages,
+	}
+}
+
+func (t *TemplateStorages) Execute(wr io.Writer) error {
+	return t.TemplateBase.ExecuteTemplate(wr, *t)
+}
+
+type TemplateUnavailable struct {
+	TemplateBase
+	Title      string
+	RetryAfter int
+}
+
+func NewTemplateUnavailable(title string, retryAfter int) *TemplateUnavailable {
+	return &TemplateUnavailable{
+		TemplateBase: *NewTemplateBase("unavailable.html"),
+		Title:        title,
+		RetryAfter:   retryAfter,
+	}
+}
+
+func (t *TemplateUnavailable) Execute(wr io.Writer) error {
+	return t.TemplateBase.ExecuteTemplate(wr, *t)
+}
+
+type TemplateChangePassword struct {
+	TemplateBase
+	Title       string
+	StorageName string
+}
+
+func NewTemplateChangePassword(title string, storageName string) *TemplateChangePassword {
+	return &TemplateChangePassword{
+		TemplateBase: *NewTemplateBase("password.html"),
+		Title:        title,
+		StorageName:  storageName,
+	}
+}
+
+func (t *TemplateChangePassword) Execute(wr io.Writer) error {
+	return t.TemplateBase.ExecuteTemplate(wr, *t)
+}
+
+type TemplateDeleteStorage struct {
+	TemplateBase
+	Title       string
+	StorageName string
+}
+
+func NewTemplateDeleteStorage(title string, storageName string) *TemplateDeleteStorage {
+	return &TemplateDeleteStorage{
+		TemplateBase: *NewTemplateBase("delete_storage.html"),
+		Title:        title,
+		StorageName:  storageName,
+	}
+}
+
+func (t *TemplateDeleteStorage) Execute(wr io.Writer) error {
+	return t.TemplateBase.ExecuteTemplate(wr, *t)
+}
+
+// APITokenInfo represents one personal api token for templating
+type APITokenInfo struct {
+	ID        string
+	Label     string
+	Scopes    string
+	CreatedAt int64
+	// ExpiresAt is zero for tokens without expiration
+	ExpiresAt int64
+	Expired   bool
+}
+
+type TemplateAPITokens struct {
+	TemplateBase
+	Title       string
+	StorageName string
+	// NewToken is shown once right after creation
+	NewToken string
+	Tokens   []APITokenInfo
+}
+
+func NewTemplateAPITokens(title string, storageName string) *TemplateAPITokens {
+	return &TemplateAPITokens{
+		TemplateBase: *NewTemplateBase("api_tokens.html"),
+		Title:        title,
+		StorageName:  storageName,
+	}
+}
+
+func (t *TemplateAPITokens) Execute(wr io.Writer) error {
+	return t.TemplateBase.ExecuteTemplate(wr, *t)
+}
+
+type TemplateShare struct {
+	TemplateBase
+	Title     string
+	FileName  string
+	ExpiresAt int64
+	// DownloadsLeft is zero for links limited by expiration only
+	DownloadsLeft int
+	NeedPassword  bool
+	// IsPage is set for public storage page instead of single file
+	IsPage bool
+}
+
+func NewTemplateShare(title string) *TemplateShare {
+	return &TemplateShare{
+		TemplateBase: *NewTemplateBase("share.html"),
+		Title:        title,
+	}
+}
+
+func (t *TemplateShare) Execute(wr io.Writer) error {
+	return t.TemplateBase.ExecuteTemplate(wr, *t)
+}
+
+// PublicPageInfo represents one published storage page for templating
+type PublicPageInfo struct {
+	ID          string
+	URL         string
+	Permanent   bool
+	HasPassword bool
+	CreatedAt   int64
+	// ExpiresAt is zero for pages without expiration
+	ExpiresAt int64
+	Expired   bool
+}
+
+type TemplatePublicPages struct {
+	TemplateBase
+	Title       string
+	StorageName string
+	Pages       []PublicPageInfo
+}
+
+func NewTemplatePublicPages(title string, storageName string) *TemplatePublicPages {
+	return &TemplatePublicPages{
+		TemplateBase: *NewTemplateBase("public_pages.html"),
+		Title:        title,
+		StorageName:  storageName,
+	}
+}
+
+func (t *TemplatePublicPages) Execute(wr io.Writer) error {
+	return t.TemplateBase.ExecuteTemplate(wr, *t)
+}
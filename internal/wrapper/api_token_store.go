@@ -0,0 +1,180 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/handler"
+)
+
+// MemoryTokenStore keeps personal api tokens in memory
+type MemoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]handler.APIToken
+}
+
+// NewMemoryTokenStore constructor for MemoryTokenStore
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		tokens: make(map[string]handler.APIToken),
+	}
+}
+
+func (ms *MemoryTokenStore) Get(id string) (handler.APIToken, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	t, ok := ms.tokens[id]
+	if !ok {
+		return handler.APIToken{}, false, nil
+	}
+
+	return copyAPIToken(t), true, nil
+}
+
+func (ms *MemoryTokenStore) List(storage string) ([]handler.APIToken, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var tokens []handler.APIToken
+	for _, t := range ms.tokens {
+		if t.Storage == storage {
+			tokens = append(tokens, copyAPIToken(t))
+		}
+	}
+
+	return tokens, nil
+}
+
+func (ms *MemoryTokenStore) Save(t handler.APIToken) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.tokens[t.ID] = copyAPIToken(t)
+	return nil
+}
+
+func (ms *MemoryTokenStore) UpdateGatewayToken(id string, gatewayToken string) (bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.updateGatewayToken(id, gatewayToken), nil
+}
+
+func (ms *MemoryTokenStore) Delete(storage string, id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.delete(storage, id)
+	return nil
+}
+
+func (ms *MemoryTokenStore) DeleteStorage(storage string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.deleteStorage(storage)
+	return nil
+}
+
+// updateGatewayToken updates token only if it is not removed, caller should hold the lock
+func (ms *MemoryTokenStore) updateGatewayToken(id string, gatewayToken string) bool {
+	t, ok := ms.tokens[id]
+	if !ok {
+		return false
+	}
+
+	t.GatewayToken = gatewayToken
+	ms.tokens[id] = t
+	return true
+}
+
+// delete removes token only if it belongs to the storage, caller should hold the lock
+func (ms *MemoryTokenStore) delete(storage string, id string) {
+	if t, ok := ms.tokens[id]; ok && t.Storage == storage {
+		delete(ms.tokens, id)
+	}
+}
+
+func (ms *MemoryTokenStore) deleteStorage(storage string) {
+	for id, t := range ms.tokens {
+		if t.Storage == storage {
+			delete(ms.tokens, id)
+		}
+	}
+}
+
+func copyAPIToken(t handler.APIToken) handler.APIToken {
+	t.Scopes = append([]string(nil), t.Scopes...)
+	return t
+}
+
+// FileTokenStore is MemoryTokenStore persisted to the json file
+// the file contains gateway tokens and should be readable by the service only
+type FileTokenStore struct {
+	*MemoryTokenStore
+	path string
+}
+
+// NewFileTokenStore loads tokens from the file if it exists
+func NewFileTokenStore(path string) (*FileTokenStore, error) {
+	fs := &FileTokenStore{
+		MemoryTokenStore: NewMemoryTokenStore(),
+		path:             path,
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fs, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read tokens file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &fs.tokens); err != nil {
+		return nil, fmt.Errorf("decode tokens file: %w", err)
+	}
+
+	if fs.tokens == nil {
+		fs.tokens = make(map[string]handler.APIToken)
+	}
+
+	return fs, nil
+}
+
+func (fs *FileTokenStore) Save(t handler.APIToken) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.tokens[t.ID] = copyAPIToken(t)
+	return writeJSONFile(fs.path, fs.tokens)
+}
+
+func (fs *FileTokenStore) UpdateGatewayToken(id string, gatewayToken string) (bool, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if !fs.updateGatewayToken(id, gatewayToken) {
+		return false, nil
+	}
+	return true, writeJSONFile(fs.path, fs.tokens)
+}
+
+func (fs *FileTokenStore) Delete(storage string, id string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.delete(storage, id)
+	return writeJSONFile(fs.path, fs.tokens)
+}
+
+func (fs *FileTokenStore) DeleteStorage(storage string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.deleteStorage(storage)
+	return writeJSONFile(fs.path, fs.tokens)
+}
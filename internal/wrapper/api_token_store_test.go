@@ -0,0 +1,60 @@
+package wrapper
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/handler"
+)
+
+func TestTokenStoreUpdateGatewayToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	fileStore, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatalf("file token store: %v", err)
+	}
+
+	stores := map[string]handler.APITokenStore{
+		"memory": NewMemoryTokenStore(),
+		"file":   fileStore,
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			if err := store.Save(handler.APIToken{ID: "t1", Storage: "s1", GatewayToken: "gw1"}); err != nil {
+				t.Fatalf("save: %v", err)
+			}
+
+			updated, err := store.UpdateGatewayToken("t1", "gw2")
+			if err != nil || !updated {
+				t.Fatalf("update existing token: updated = %t, err = %v", updated, err)
+			}
+
+			if token, _, _ := store.Get("t1"); token.GatewayToken != "gw2" || token.Storage != "s1" {
+				t.Errorf("token after update = %+v", token)
+			}
+
+			if err := store.Delete("s1", "t1"); err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+
+			updated, err = store.UpdateGatewayToken("t1", "gw3")
+			if err != nil || updated {
+				t.Fatalf("update revoked token: updated = %t, err = %v", updated, err)
+			}
+
+			if _, ok, _ := store.Get("t1"); ok {
+				t.Fatal("revoked token is restored by update")
+			}
+		})
+	}
+
+	reloaded, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatalf("reload file token store: %v", err)
+	}
+
+	if _, ok, _ := reloaded.Get("t1"); ok {
+		t.Fatal("revoked token is restored in the file")
+	}
+}
@@ -0,0 +1,148 @@
+package wrapper
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// MinCookieKeyLength minimal length of the cookie secret key
+	MinCookieKeyLength = 32
+
+	timestampLength = 8
+)
+
+var (
+	// ErrInvalidCookie indicates that cookie value was not issued by any of known keys or was tampered
+	ErrInvalidCookie = errors.New("invalid cookie")
+	// ErrExpiredCookie indicates that cookie is older than allowed max age
+	ErrExpiredCookie = errors.New("expired cookie")
+)
+
+type cookieKey struct {
+	aead    cipher.AEAD
+	signKey []byte
+}
+
+// CookieCodec encrypts and signs cookie values
+// the first key is used for encoding, all keys are accepted for decoding so the keys could be rotated
+type CookieCodec struct {
+	keys []cookieKey
+}
+
+// NewCookieCodec constructor for CookieCodec
+// encryption and signing keys are derived from every secret separately
+func NewCookieCodec(secrets ...[]byte) (*CookieCodec, error) {
+	if len(secrets) == 0 {
+		return nil, errors.New("at least one cookie key is required")
+	}
+
+	keys := make([]cookieKey, 0, len(secrets))
+	for i, secret := range secrets {
+		if len(secret) < MinCookieKeyLength {
+			return nil, fmt.Errorf("cookie key %d is shorter than %d bytes", i, MinCookieKeyLength)
+		}
+
+		block, err := aes.NewCipher(deriveKey(secret, "encryption"))
+		if err != nil {
+			return nil, fmt.Errorf("cipher: %w", err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("gcm: %w", err)
+		}
+
+		keys = append(keys, cookieKey{
+			aead:    aead,
+			signKey: deriveKey(secret, "signing"),
+		})
+	}
+
+	return &CookieCodec{
+		keys: keys,
+	}, nil
+}
+
+func deriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// Encode encrypts value and signs it together with cookie name and issue time
+// so the value cannot be moved to another cookie
+func (c *CookieCodec) Encode(name string, value string) (string, error) {
+	key := c.keys[0]
+
+	nonce := make([]byte, key.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("nonce: %w", err)
+	}
+
+	payload := make([]byte, timestampLength, timestampLength+len(nonce)+len(value)+key.aead.Overhead())
+	binary.BigEndian.PutUint64(payload, uint64(time.Now().Unix()))
+	payload = append(payload, nonce...)
+	payload = key.aead.Seal(payload, nonce, []byte(value), []byte(name))
+
+	payload = append(payload, sign(key.signKey, name, payload)...)
+
+	return base64.RawURLEncoding.EncodeToString(payload), nil
+}
+
+// Decode verifies and decrypts cookie value
+// maxAge limits cookie lifetime on the server side as well, zero means no limit
+func (c *CookieCodec) Decode(name string, encoded string, maxAge time.Duration) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+
+	if len(raw) < timestampLength+sha256.Size {
+		return "", ErrInvalidCookie
+	}
+
+	payload, signature := raw[:len(raw)-sha256.Size], raw[len(raw)-sha256.Size:]
+
+	for _, key := range c.keys {
+		if !hmac.Equal(signature, sign(key.signKey, name, payload)) {
+			continue
+		}
+
+		nonceSize := key.aead.NonceSize()
+		if len(payload) < timestampLength+nonceSize {
+			return "", ErrInvalidCookie
+		}
+
+		issuedAt := time.Unix(int64(binary.BigEndian.Uint64(payload[:timestampLength])), 0)
+		if maxAge > 0 && time.Since(issuedAt) > maxAge {
+			return "", ErrExpiredCookie
+		}
+
+		nonce := payload[timestampLength : timestampLength+nonceSize]
+		value, err := key.aead.Open(nil, nonce, payload[timestampLength+nonceSize:], []byte(name))
+		if err != nil {
+			return "", ErrInvalidCookie
+		}
+
+		return string(value), nil
+	}
+
+	return "", ErrInvalidCookie
+}
+
+func sign(key []byte, name string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,150 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func testCookieKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, MinCookieKeyLength)
+}
+
+func newTestCodec(t *testing.T, secrets ...[]byte) *CookieCodec {
+	t.Helper()
+
+	if len(secrets) == 0 {
+		secrets = [][]byte{testCookieKey('a')}
+	}
+
+	codec, err := NewCookieCodec(secrets...)
+	if err != nil {
+		t.Fatalf("cookie codec: %v", err)
+	}
+	return codec
+}
+
+func TestCookieCodecRoundTrip(t *testing.T) {
+	codec := newTestCodec(t)
+
+	encoded, err := codec.Encode("fs_s1", "token")
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("encoded value is not base64: %v", err)
+	}
+	if bytes.Contains(raw, []byte("token")) {
+		t.Fatal("value is not encrypted")
+	}
+
+	value, err := codec.Decode("fs_s1", encoded, time.Minute)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if value != "token" {
+		t.Fatalf("value = %q, want token", value)
+	}
+}
+
+func TestCookieCodecRejects(t *testing.T) {
+	codec := newTestCodec(t)
+
+	encoded, err := codec.Encode("fs_s1", "token")
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	raw, _ := base64.RawURLEncoding.DecodeString(encoded)
+	raw[len(raw)/2] ^= 1
+	tampered := base64.RawURLEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		name    string
+		codec   *CookieCodec
+		cookie  string
+		value   string
+		wantErr error
+	}{
+		{name: "tampered value", codec: codec, cookie: "fs_s1", value: tampered, wantErr: ErrInvalidCookie},
+		{name: "wrong cookie name", codec: codec, cookie: "fs_s2", value: encoded, wantErr: ErrInvalidCookie},
+		{name: "unknown key", codec: newTestCodec(t, testCookieKey('b')), cookie: "fs_s1", value: encoded, wantErr: ErrInvalidCookie},
+		{name: "not base64", codec: codec, cookie: "fs_s1", value: "!!!", wantErr: ErrInvalidCookie},
+		{name: "truncated", codec: codec, cookie: "fs_s1", value: encoded[:10], wantErr: ErrInvalidCookie},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.codec.Decode(tt.cookie, tt.value, 0); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCookieCodecMaxAge(t *testing.T) {
+	codec := newTestCodec(t)
+
+	encoded, err := codec.Encode("fs_s1", "token")
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	// issue time is truncated to seconds so the cookie is always older than a nanosecond
+	if _, err := codec.Decode("fs_s1", encoded, time.Nanosecond); !errors.Is(err, ErrExpiredCookie) {
+		t.Fatalf("error = %v, want %v", err, ErrExpiredCookie)
+	}
+}
+
+func TestCookieCodecKeyRotation(t *testing.T) {
+	oldKey, newKey := testCookieKey('a'), testCookieKey('b')
+
+	encoded, err := newTestCodec(t, oldKey).Encode("fs_s1", "token")
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	rotated := newTestCodec(t, newKey, oldKey)
+	value, err := rotated.Decode("fs_s1", encoded, 0)
+	if err != nil || value != "token" {
+		t.Fatalf("old cookie after rotation: value = %q, err = %v", value, err)
+	}
+
+	// new cookies are encoded with the first key only
+	reissued, err := rotated.Encode("fs_s1", "token")
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	if _, err := newTestCodec(t, oldKey).Decode("fs_s1", reissued, 0); !errors.Is(err, ErrInvalidCookie) {
+		t.Fatalf("cookie encoded after rotation is accepted by old key only codec: %v", err)
+	}
+
+	if _, err := newTestCodec(t, newKey).Decode("fs_s1", reissued, 0); err != nil {
+		t.Fatalf("cookie encoded after rotation: %v", err)
+	}
+}
+
+func TestNewCookieCodecKeys(t *testing.T) {
+	if _, err := NewCookieCodec(); err == nil {
+		t.Error("codec without keys is created")
+	}
+
+	if _, err := NewCookieCodec(testCookieKey('a'), []byte("short")); err == nil {
+		t.Error("codec with short key is created")
+	}
+}
+
+func TestNewCookieSessionRequiresCodec(t *testing.T) {
+	if _, err := NewCookieSession(3600, nil); err == nil {
+		t.Error("cookie session without codec is created")
+	}
+
+	if _, err := NewServerSession(3600, NewMemoryStore(), nil); err == nil {
+		t.Error("server session without codec is created")
+	}
+}
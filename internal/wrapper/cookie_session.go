@@ -1,47 +1,303 @@
 package wrapper
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/Mikhalevich/filesharing-web-service/internal/handler"
 )
 
+const (
+	// DefaultCookiePrefix separates storage session cookies from other ones
+	DefaultCookiePrefix = "fs_"
+
+	// touchInterval limits how often session cookie is reissued on activity
+	touchInterval = time.Minute
+)
+
+var (
+	errSessionExpired = errors.New("session max lifetime is reached")
+)
+
+// Lifetime describes sliding session expiration
+type Lifetime struct {
+	// Idle is the period of inactivity after which session expires
+	Idle time.Duration
+	// Max is absolute session lifetime regardless of activity, zero means no limit
+	Max time.Duration
+}
+
+func (l Lifetime) expiresAt(createdAt time.Time, now time.Time) time.Time {
+	expiresAt := now.Add(l.Idle)
+	if limit := createdAt.Add(l.Max); l.Max > 0 && expiresAt.After(limit) {
+		return limit
+	}
+	return expiresAt
+}
+
+// cookiePayload is stored in the session cookie
+type cookiePayload struct {
+	Value     string `json:"v"`
+	CreatedAt int64  `json:"c"`
+	IssuedAt  int64  `json:"i"`
+	Remember  bool   `json:"r,omitempty"`
+}
+
 type CookieSession struct {
-	expirePeriod int64
+	lifetime         Lifetime
+	rememberLifetime Lifetime
+	codec            *CookieCodec
+	prefix           string
+	domain           string
+	secure           bool
+	sameSite         http.SameSite
+}
+
+// CookieOption configures optional CookieSession parameters
+type CookieOption func(cs *CookieSession)
+
+// WithCookiePrefix sets prefix for session cookie names
+func WithCookiePrefix(prefix string) CookieOption {
+	return func(cs *CookieSession) {
+		cs.prefix = prefix
+	}
+}
+
+// WithCookieDomain sets domain attribute of session cookies
+func WithCookieDomain(domain string) CookieOption {
+	return func(cs *CookieSession) {
+		cs.domain = domain
+	}
+}
+
+// WithCookieSecure sets secure attribute of session cookies
+func WithCookieSecure(secure bool) CookieOption {
+	return func(cs *CookieSession) {
+		cs.secure = secure
+	}
 }
 
-func NewCookieSession(period int64) *CookieSession {
-	return &CookieSession{
-		expirePeriod: period,
+// WithCookieSameSite sets same site attribute of session cookies
+func WithCookieSameSite(sameSite http.SameSite) CookieOption {
+	return func(cs *CookieSession) {
+		cs.sameSite = sameSite
 	}
 }
 
+// WithMaxLifetime limits session lifetime regardless of activity
+func WithMaxLifetime(max time.Duration) CookieOption {
+	return func(cs *CookieSession) {
+		cs.lifetime.Max = max
+	}
+}
+
+// WithRememberLifetime sets lifetime of sessions signed in with remember me option
+func WithRememberLifetime(l Lifetime) CookieOption {
+	return func(cs *CookieSession) {
+		cs.rememberLifetime = l
+	}
+}
+
+// NewCookieSession constructor for CookieSession
+// period is idle session lifetime in seconds, it is extended on activity
+// codec encrypts and signs session cookies, it is required because unsigned cookies could be forged
+func NewCookieSession(period int64, codec *CookieCodec, opts ...CookieOption) (*CookieSession, error) {
+	if codec == nil {
+		return nil, errors.New("cookie codec is required")
+	}
+
+	idle := time.Duration(period) * time.Second
+	cs := &CookieSession{
+		lifetime:         Lifetime{Idle: idle, Max: idle},
+		rememberLifetime: Lifetime{Idle: idle, Max: idle},
+		codec:            codec,
+		prefix:           DefaultCookiePrefix,
+		sameSite:         http.SameSiteLaxMode,
+	}
+
+	for _, opt := range opts {
+		opt(cs)
+	}
+
+	return cs, nil
+}
+
+// ParseSameSite converts config value to the cookie same site mode
+func ParseSameSite(mode string) (http.SameSite, error) {
+	switch strings.ToLower(mode) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return http.SameSiteDefaultMode, fmt.Errorf("invalid same site mode: %s", mode)
+}
+
 func (cs *CookieSession) GetToken(name string, r *http.Request) *handler.Token {
 	if name == "" {
 		return nil
 	}
 
+	p, ok := cs.read(r, name)
+	if !ok {
+		return nil
+	}
+
+	return &handler.Token{
+		Value:    p.Value,
+		Remember: p.Remember,
+	}
+}
+
+func (cs *CookieSession) SetToken(w http.ResponseWriter, r *http.Request, token *handler.Token, name string) error {
+	_, err := cs.setToken(w, r, token, name)
+	return err
+}
+
+// setToken stores token and returns session expiration time
+// token refreshed by gateway continues the current session lifetime
+func (cs *CookieSession) setToken(w http.ResponseWriter, r *http.Request, token *handler.Token, name string) (time.Time, error) {
+	p, ok := cs.read(r, name)
+	if !ok || token.SignIn {
+		p = cookiePayload{
+			CreatedAt: time.Now().Unix(),
+			Remember:  token.Remember,
+		}
+	}
+	p.Value = token.Value
+
+	return cs.write(w, r, name, p)
+}
+
+// Touch reissues session cookie with extended expiration
+func (cs *CookieSession) Touch(w http.ResponseWriter, r *http.Request, name string) {
+	cs.touch(w, r, name)
+}
+
+func (cs *CookieSession) touch(w http.ResponseWriter, r *http.Request, name string) (time.Time, bool) {
+	p, ok := cs.read(r, name)
+	if !ok || time.Since(time.Unix(p.IssuedAt, 0)) < touchInterval {
+		return time.Time{}, false
+	}
+
+	expiresAt, err := cs.write(w, r, name, p)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return expiresAt, true
+}
+
+func (cs *CookieSession) Remove(w http.ResponseWriter, r *http.Request, name string) {
+	http.SetCookie(w, cs.cookie(cs.prefix+name, "", time.Unix(0, 0)))
+}
+
+// Storages returns names of all storages with valid session cookie
+func (cs *CookieSession) Storages(r *http.Request) []string {
+	var names []string
 	for _, cook := range r.Cookies() {
-		if cook.Name != name {
+		if cook.Value == "" || cook.Name == handler.CSRFCookieName || !strings.HasPrefix(cook.Name, cs.prefix) {
 			continue
 		}
 
-		return &handler.Token{
-			Value: cook.Value,
+		name := strings.TrimPrefix(cook.Name, cs.prefix)
+		if _, ok := cs.read(r, name); !ok {
+			continue
 		}
+
+		names = append(names, name)
+	}
+
+	return names
+}
+
+func (cs *CookieSession) lifetimeOf(remember bool) Lifetime {
+	if remember {
+		return cs.rememberLifetime
+	}
+	return cs.lifetime
+}
+
+// read returns valid not expired cookie payload
+func (cs *CookieSession) read(r *http.Request, name string) (cookiePayload, bool) {
+	cook, err := r.Cookie(cs.prefix + name)
+	if err != nil || cook.Value == "" {
+		return cookiePayload{}, false
+	}
+
+	data, err := cs.decode(cook)
+	if err != nil {
+		return cookiePayload{}, false
+	}
+
+	var p cookiePayload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return cookiePayload{}, false
+	}
+
+	now := time.Now()
+	expiresAt := cs.lifetimeOf(p.Remember).expiresAt(time.Unix(p.CreatedAt, 0), time.Unix(p.IssuedAt, 0))
+	if !now.Before(expiresAt) {
+		return cookiePayload{}, false
+	}
+
+	return p, true
+}
+
+func (cs *CookieSession) write(w http.ResponseWriter, r *http.Request, name string, p cookiePayload) (time.Time, error) {
+	now := time.Now()
+	p.IssuedAt = now.Unix()
+	expiresAt := cs.lifetimeOf(p.Remember).expiresAt(time.Unix(p.CreatedAt, 0), now)
+	if !now.Before(expiresAt) {
+		cs.Remove(w, r, name)
+		return time.Time{}, errSessionExpired
 	}
 
-	return nil
+	value, err := cs.encode(cs.prefix+name, p)
+	if err != nil {
+		// session without protection is worse than no session at all
+		cs.Remove(w, r, name)
+		return time.Time{}, fmt.Errorf("encode session cookie: %w", err)
+	}
+
+	http.SetCookie(w, cs.cookie(cs.prefix+name, value, expiresAt))
+	return expiresAt, nil
 }
 
-func (cs *CookieSession) SetToken(w http.ResponseWriter, token *handler.Token, name string) {
-	cookie := http.Cookie{Name: name, Value: token.Value, Path: "/", Expires: time.Now().Add(time.Duration(cs.expirePeriod) * time.Second), HttpOnly: true}
-	http.SetCookie(w, &cookie)
+func (cs *CookieSession) encode(cookieName string, p cookiePayload) (string, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+
+	return cs.codec.Encode(cookieName, string(data))
 }
 
-func (cs *CookieSession) Remove(w http.ResponseWriter, name string) {
-	http.SetCookie(w, &http.Cookie{Name: name, Value: "", Path: "/", Expires: time.Unix(0, 0), HttpOnly: true})
+func (cs *CookieSession) decode(cook *http.Cookie) ([]byte, error) {
+	// expiration is checked against payload times
+	value, err := cs.codec.Decode(cook.Name, cook.Value, 0)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(value), nil
+}
+
+func (cs *CookieSession) cookie(name string, value string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   cs.domain,
+		Expires:  expires,
+		Secure:   cs.secure,
+		HttpOnly: true,
+		SameSite: cs.sameSite,
+	}
 }
 
 // func (cs *CookieSession) Create() goauth.Session {
@@ -0,0 +1,164 @@
+package wrapper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/handler"
+)
+
+func newTestCookieSession(t *testing.T, opts ...CookieOption) *CookieSession {
+	t.Helper()
+
+	cs, err := NewCookieSession(3600, newTestCodec(t), opts...)
+	if err != nil {
+		t.Fatalf("cookie session: %v", err)
+	}
+	return cs
+}
+
+// requestWithPayload makes request carrying session cookie of the storage with the payload
+func requestWithPayload(t *testing.T, cs *CookieSession, name string, p cookiePayload) *http.Request {
+	t.Helper()
+
+	value, err := cs.encode(cs.prefix+name, p)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: cs.prefix + name, Value: value})
+	return r
+}
+
+func responseCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestCookieSessionSlidingExpiry(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		createdAt time.Time
+		issuedAt  time.Time
+		remember  bool
+		wantValid bool
+	}{
+		{name: "active", createdAt: now.Add(-time.Minute), issuedAt: now.Add(-time.Minute), wantValid: true},
+		{name: "idle", createdAt: now.Add(-2 * time.Hour), issuedAt: now.Add(-2 * time.Hour)},
+		{name: "extended by activity", createdAt: now.Add(-90 * time.Minute), issuedAt: now.Add(-time.Minute), wantValid: true},
+		{name: "max lifetime", createdAt: now.Add(-3 * time.Hour), issuedAt: now.Add(-time.Minute)},
+		{name: "remembered", createdAt: now.Add(-48 * time.Hour), issuedAt: now.Add(-12 * time.Hour), remember: true, wantValid: true},
+		{name: "remembered idle", createdAt: now.Add(-48 * time.Hour), issuedAt: now.Add(-25 * time.Hour), remember: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := newTestCookieSession(t,
+				WithMaxLifetime(2*time.Hour),
+				WithRememberLifetime(Lifetime{Idle: 24 * time.Hour, Max: 30 * 24 * time.Hour}),
+			)
+
+			r := requestWithPayload(t, cs, "s1", cookiePayload{
+				Value:     "token",
+				CreatedAt: tt.createdAt.Unix(),
+				IssuedAt:  tt.issuedAt.Unix(),
+				Remember:  tt.remember,
+			})
+
+			token := cs.GetToken("s1", r)
+			if valid := token != nil; valid != tt.wantValid {
+				t.Fatalf("valid = %t, want %t", valid, tt.wantValid)
+			}
+
+			if names := cs.Storages(r); (len(names) == 1) != tt.wantValid {
+				t.Errorf("storages = %v", names)
+			}
+		})
+	}
+}
+
+func TestCookieSessionTouch(t *testing.T) {
+	cs := newTestCookieSession(t, WithMaxLifetime(2*time.Hour))
+	createdAt := time.Now().Add(-90 * time.Minute)
+
+	// recently issued cookie is not reissued on every request
+	w := httptest.NewRecorder()
+	cs.Touch(w, requestWithPayload(t, cs, "s1", cookiePayload{
+		Value:     "token",
+		CreatedAt: createdAt.Unix(),
+		IssuedAt:  time.Now().Unix(),
+	}), "s1")
+	if c := responseCookie(w, cs.prefix+"s1"); c != nil {
+		t.Fatalf("recently issued cookie is reissued")
+	}
+
+	w = httptest.NewRecorder()
+	cs.Touch(w, requestWithPayload(t, cs, "s1", cookiePayload{
+		Value:     "token",
+		CreatedAt: createdAt.Unix(),
+		IssuedAt:  time.Now().Add(-10 * time.Minute).Unix(),
+	}), "s1")
+
+	c := responseCookie(w, cs.prefix+"s1")
+	if c == nil {
+		t.Fatal("cookie is not reissued")
+	}
+
+	// idle period is one hour from now but max lifetime ends in 30 minutes
+	wantExpires := createdAt.Add(2 * time.Hour)
+	if d := c.Expires.Sub(wantExpires); d < -time.Second || d > time.Second {
+		t.Errorf("expires = %v, want %v", c.Expires, wantExpires)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(c)
+	if token := cs.GetToken("s1", r); token == nil || token.Value != "token" {
+		t.Fatalf("token after touch = %+v", token)
+	}
+}
+
+func TestCookieSessionRefreshKeepsLifetime(t *testing.T) {
+	cs := newTestCookieSession(t, WithMaxLifetime(2*time.Hour))
+	createdAt := time.Now().Add(-90 * time.Minute)
+	r := requestWithPayload(t, cs, "s1", cookiePayload{
+		Value:     "old",
+		CreatedAt: createdAt.Unix(),
+		IssuedAt:  time.Now().Add(-time.Minute).Unix(),
+	})
+
+	tests := []struct {
+		name        string
+		token       *handler.Token
+		wantExpires time.Time
+	}{
+		{name: "refreshed token", token: &handler.Token{Value: "new"}, wantExpires: createdAt.Add(2 * time.Hour)},
+		{name: "sign in", token: &handler.Token{Value: "new", SignIn: true}, wantExpires: time.Now().Add(time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if err := cs.SetToken(w, r, tt.token, "s1"); err != nil {
+				t.Fatalf("set token: %v", err)
+			}
+
+			c := responseCookie(w, cs.prefix+"s1")
+			if c == nil {
+				t.Fatal("cookie is not set")
+			}
+
+			if d := c.Expires.Sub(tt.wantExpires); d < -time.Second || d > time.Second {
+				t.Errorf("expires = %v, want %v", c.Expires, tt.wantExpires)
+			}
+		})
+	}
+}
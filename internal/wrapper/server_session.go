@@ -0,0 +1,273 @@
+package wrapper
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/handler"
+)
+
+const (
+	sessionCookieName = "session"
+	sessionIDLength   = 32
+)
+
+// ServerSession keeps storage tokens in the server side store, browser holds opaque session id only
+// session lifetime is driven by the session id cookie
+type ServerSession struct {
+	store   SessionStore
+	cookies *CookieSession
+}
+
+// NewServerSession constructor for ServerSession
+// codec and cookie options are applied to the session id cookie
+func NewServerSession(period int64, store SessionStore, codec *CookieCodec, opts ...CookieOption) (*ServerSession, error) {
+	cookies, err := NewCookieSession(period, codec, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServerSession{
+		store:   store,
+		cookies: cookies,
+	}, nil
+}
+
+func (ss *ServerSession) GetToken(name string, r *http.Request) *handler.Token {
+	if name == "" {
+		return nil
+	}
+
+	s, ok := ss.session(r)
+	if !ok {
+		return nil
+	}
+
+	token, ok := s.token(name, time.Now())
+	if !ok {
+		return nil
+	}
+
+	return &handler.Token{
+		Value: token,
+	}
+}
+
+// SetToken stores token in the browser session
+// sign in always moves the session to the new id, so id planted in the browser before can not be used to take over the session
+// sign in starts lifetime of the signed in storage only, other storages keep their own
+func (ss *ServerSession) SetToken(w http.ResponseWriter, r *http.Request, token *handler.Token, name string) error {
+	id, issued := ss.sessionID(w, r)
+	s, ok, err := ss.store.Get(id)
+	if err != nil {
+		return fmt.Errorf("get session: %w", err)
+	}
+
+	if !ok {
+		s = Session{Tokens: make(map[string]string)}
+	}
+
+	prevID := ""
+	if !ok || (token.SignIn && !issued) {
+		if ok {
+			prevID = id
+		}
+
+		id, err = newSessionID()
+		if err != nil {
+			return fmt.Errorf("session id: %w", err)
+		}
+	}
+
+	if s.Storages == nil {
+		s.Storages = make(map[string]StorageSession)
+	}
+
+	if st, ok := s.Storages[name]; !ok || token.SignIn {
+		st = StorageSession{
+			CreatedAt: time.Unix(time.Now().Unix(), 0),
+			Remember:  token.Remember,
+		}
+		s.Storages[name] = st
+	}
+	s.Tokens[name] = token.Value
+
+	if err := ss.extend(w, r, id, &s); err != nil {
+		return err
+	}
+
+	if err := ss.store.Save(id, s); err != nil {
+		return fmt.Errorf("save session: %w", err)
+	}
+
+	if prevID != "" {
+		if err := ss.store.Delete(prevID); err != nil {
+			return fmt.Errorf("delete previous session: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Touch extends browser session, the session is shared by all storages so name is not used
+func (ss *ServerSession) Touch(w http.ResponseWriter, r *http.Request, name string) {
+	if _, issued := ss.sessionID(w, r); issued {
+		return
+	}
+
+	p, ok := ss.cookies.read(r, sessionCookieName)
+	if !ok || time.Since(time.Unix(p.IssuedAt, 0)) < touchInterval {
+		return
+	}
+
+	s, ok, err := ss.store.Get(p.Value)
+	if err != nil || !ok {
+		return
+	}
+
+	if err := ss.extend(w, r, p.Value, &s); err != nil {
+		if errors.Is(err, errSessionExpired) {
+			ss.store.Delete(p.Value)
+		}
+		return
+	}
+
+	ss.store.Save(p.Value, s)
+}
+
+func (ss *ServerSession) Remove(w http.ResponseWriter, r *http.Request, name string) {
+	id, _ := ss.sessionID(w, r)
+	s, ok, err := ss.store.Get(id)
+	if err != nil || !ok {
+		return
+	}
+
+	s.remove(name)
+	if len(s.Tokens) > 0 {
+		ss.store.Save(id, s)
+		return
+	}
+
+	ss.store.Delete(id)
+	ss.cookies.Remove(w, r, sessionCookieName)
+}
+
+// Storages returns names of all storages signed in within the browser session
+func (ss *ServerSession) Storages(r *http.Request) []string {
+	s, ok := ss.session(r)
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	names := make([]string, 0, len(s.Tokens))
+	for name := range s.Tokens {
+		if _, ok := s.token(name, now); ok {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// RevokeStorage signs out storage from all browser sessions
+func (ss *ServerSession) RevokeStorage(name string) error {
+	return ss.store.RevokeStorage(name)
+}
+
+func (ss *ServerSession) session(r *http.Request) (Session, bool) {
+	token := ss.cookies.GetToken(sessionCookieName, r)
+	if token == nil {
+		return Session{}, false
+	}
+
+	s, ok, err := ss.store.Get(token.Value)
+	if err != nil || !ok {
+		return Session{}, false
+	}
+
+	return s, true
+}
+
+// extend slides lifetime of every storage in the session and reissues session cookie
+// the cookie lives as long as the longest living storage sign in, expired storages are dropped
+func (ss *ServerSession) extend(w http.ResponseWriter, r *http.Request, id string, s *Session) error {
+	if s.Storages == nil {
+		s.Storages = make(map[string]StorageSession)
+	}
+
+	now := time.Now()
+	var longest StorageSession
+	for name := range s.Tokens {
+		st, ok := s.Storages[name]
+		if !ok {
+			st = StorageSession{CreatedAt: time.Unix(now.Unix(), 0)}
+		}
+
+		st.ExpiresAt = ss.cookies.lifetimeOf(st.Remember).expiresAt(st.CreatedAt, now)
+		if !now.Before(st.ExpiresAt) {
+			s.remove(name)
+			continue
+		}
+
+		s.Storages[name] = st
+		if st.ExpiresAt.After(longest.ExpiresAt) {
+			longest = st
+		}
+	}
+
+	if len(s.Tokens) == 0 {
+		ss.cookies.Remove(w, r, sessionCookieName)
+		return errSessionExpired
+	}
+
+	expiresAt, err := ss.cookies.write(w, r, sessionCookieName, cookiePayload{
+		Value:     id,
+		CreatedAt: longest.CreatedAt.Unix(),
+		Remember:  longest.Remember,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.ExpiresAt = expiresAt
+	return nil
+}
+
+// sessionID returns session id issued within the current response or sent by the browser
+// so several tokens set during one request end up in the same session
+// issued reports that id comes from the current response
+func (ss *ServerSession) sessionID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	issued := &http.Request{Header: http.Header{"Cookie": setCookieValues(w.Header())}}
+	if token := ss.cookies.GetToken(sessionCookieName, issued); token != nil {
+		return token.Value, true
+	}
+
+	if token := ss.cookies.GetToken(sessionCookieName, r); token != nil {
+		return token.Value, false
+	}
+
+	return "", false
+}
+
+func setCookieValues(h http.Header) []string {
+	cookies := (&http.Response{Header: h}).Cookies()
+	values := make([]string, 0, len(cookies))
+	for _, c := range cookies {
+		values = append(values, c.Name+"="+c.Value)
+	}
+	return values
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, sessionIDLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,185 @@
+package wrapper
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/handler"
+)
+
+// failingStore fails save of every session
+type failingStore struct {
+	*MemoryStore
+}
+
+func (failingStore) Save(id string, s Session) error {
+	return errors.New("store is unavailable")
+}
+
+// withResponseCookies returns request sending cookies set in the response along with the request ones
+func withResponseCookies(r *http.Request, w *httptest.ResponseRecorder) *http.Request {
+	next := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range r.Cookies() {
+		next.AddCookie(c)
+	}
+	for _, c := range w.Result().Cookies() {
+		next.AddCookie(c)
+	}
+	return next
+}
+
+func newTestServerSession(t *testing.T, store SessionStore, opts ...CookieOption) *ServerSession {
+	t.Helper()
+
+	ss, err := NewServerSession(3600, store, newTestCodec(t), opts...)
+	if err != nil {
+		t.Fatalf("server session: %v", err)
+	}
+	return ss
+}
+
+func sessionCookie(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	for _, c := range w.Result().Cookies() {
+		if c.Name == DefaultCookiePrefix+sessionCookieName {
+			return c.Value
+		}
+	}
+	t.Fatal("session cookie is not set")
+	return ""
+}
+
+func TestServerSessionSignInIssuesNewID(t *testing.T) {
+	store := NewMemoryStore()
+	ss := newTestServerSession(t, store)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := ss.SetToken(w, r, &handler.Token{Value: "t1", SignIn: true}, "s1"); err != nil {
+		t.Fatalf("set token: %v", err)
+	}
+	planted := withResponseCookies(r, w)
+	plantedID, _ := ss.sessionID(httptest.NewRecorder(), planted)
+
+	w = httptest.NewRecorder()
+	if err := ss.SetToken(w, planted, &handler.Token{Value: "t2", SignIn: true}, "s2"); err != nil {
+		t.Fatalf("set token: %v", err)
+	}
+	sessionCookie(t, w)
+	signedIn := withResponseCookies(httptest.NewRequest(http.MethodGet, "/", nil), w)
+
+	newID, _ := ss.sessionID(httptest.NewRecorder(), signedIn)
+	if newID == plantedID {
+		t.Fatal("sign in keeps session id")
+	}
+
+	if _, ok, _ := store.Get(plantedID); ok {
+		t.Fatal("previous session is not deleted")
+	}
+
+	if token := ss.GetToken("s2", planted); token != nil {
+		t.Fatal("previous session id has access to the new sign in")
+	}
+
+	for name, want := range map[string]string{"s1": "t1", "s2": "t2"} {
+		if token := ss.GetToken(name, signedIn); token == nil || token.Value != want {
+			t.Fatalf("token %s = %+v, want %q", name, token, want)
+		}
+	}
+}
+
+func TestServerSessionRefreshKeepsID(t *testing.T) {
+	ss := newTestServerSession(t, NewMemoryStore())
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := ss.SetToken(w, r, &handler.Token{Value: "t1", SignIn: true}, "s1"); err != nil {
+		t.Fatalf("set token: %v", err)
+	}
+	r = withResponseCookies(r, w)
+	id, _ := ss.sessionID(httptest.NewRecorder(), r)
+
+	w = httptest.NewRecorder()
+	if err := ss.SetToken(w, r, &handler.Token{Value: "t2"}, "s1"); err != nil {
+		t.Fatalf("set token: %v", err)
+	}
+
+	refreshedID, _ := ss.sessionID(w, r)
+	if refreshedID != id {
+		t.Fatal("refresh changes session id")
+	}
+
+	if token := ss.GetToken("s1", r); token == nil || token.Value != "t2" {
+		t.Fatalf("token = %+v, want t2", token)
+	}
+}
+
+func TestServerSessionSaveError(t *testing.T) {
+	ss := newTestServerSession(t, failingStore{NewMemoryStore()})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := ss.SetToken(w, r, &handler.Token{Value: "t1", SignIn: true}, "s1"); err == nil {
+		t.Fatal("expected save error")
+	}
+}
+
+func TestServerSessionKeepsStorageLifetimes(t *testing.T) {
+	store := NewMemoryStore()
+	ss := newTestServerSession(t, store, WithRememberLifetime(Lifetime{Idle: 24 * time.Hour, Max: 30 * 24 * time.Hour}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := ss.SetToken(w, r, &handler.Token{Value: "t1", SignIn: true}, "s1"); err != nil {
+		t.Fatalf("set token: %v", err)
+	}
+	r = withResponseCookies(r, w)
+	id, _ := ss.sessionID(httptest.NewRecorder(), r)
+
+	// s1 signed in long ago, its max lifetime is almost over
+	s, _, _ := store.Get(id)
+	createdAt := time.Now().Add(-time.Hour + time.Minute).Truncate(time.Second)
+	s.Storages["s1"] = StorageSession{CreatedAt: createdAt, ExpiresAt: createdAt.Add(time.Hour)}
+	store.Save(id, s)
+
+	w = httptest.NewRecorder()
+	if err := ss.SetToken(w, r, &handler.Token{Value: "t2", SignIn: true, Remember: true}, "s2"); err != nil {
+		t.Fatalf("set token: %v", err)
+	}
+	r = withResponseCookies(httptest.NewRequest(http.MethodGet, "/", nil), w)
+	id, _ = ss.sessionID(httptest.NewRecorder(), r)
+
+	s, _, _ = store.Get(id)
+	s1 := s.Storages["s1"]
+	if !s1.CreatedAt.Equal(createdAt) || s1.Remember {
+		t.Fatalf("s1 lifetime is changed by s2 sign in: %+v", s1)
+	}
+
+	if !s1.ExpiresAt.Equal(createdAt.Add(time.Hour)) {
+		t.Fatalf("s1 expires at %v, want %v", s1.ExpiresAt, createdAt.Add(time.Hour))
+	}
+
+	if !s.ExpiresAt.After(time.Now().Add(23 * time.Hour)) {
+		t.Fatalf("session expires at %v, want remember lifetime of s2", s.ExpiresAt)
+	}
+
+	// s1 max lifetime is over while s2 keeps the browser session alive
+	s1.ExpiresAt = time.Now().Add(-time.Second)
+	s.Storages["s1"] = s1
+	store.Save(id, s)
+
+	if token := ss.GetToken("s1", r); token != nil {
+		t.Fatal("expired storage token is returned")
+	}
+
+	if token := ss.GetToken("s2", r); token == nil || token.Value != "t2" {
+		t.Fatalf("token s2 = %+v, want t2", token)
+	}
+
+	if names := ss.Storages(r); len(names) != 1 || names[0] != "s2" {
+		t.Fatalf("storages = %v, want [s2]", names)
+	}
+}
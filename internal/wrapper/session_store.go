@@ -0,0 +1,251 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	sweepInterval = time.Minute
+)
+
+// Session represents server side browser session with tokens of all signed in storages
+type Session struct {
+	Tokens map[string]string `json:"tokens"`
+	// Storages keeps lifetime of every storage sign in, storages signed in later do not extend the earlier ones
+	Storages  map[string]StorageSession `json:"storages,omitempty"`
+	ExpiresAt time.Time                 `json:"expires_at"`
+}
+
+// StorageSession describes lifetime of the storage sign in within the browser session
+type StorageSession struct {
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Remember  bool      `json:"remember,omitempty"`
+}
+
+func (s Session) expired(now time.Time) bool {
+	return !s.ExpiresAt.After(now)
+}
+
+// token returns token of the storage which sign in is not expired
+// sessions saved before storage lifetimes were tracked are limited by the session expiration only
+func (s Session) token(name string, now time.Time) (string, bool) {
+	token, ok := s.Tokens[name]
+	if !ok {
+		return "", false
+	}
+
+	if st, ok := s.Storages[name]; ok && !st.ExpiresAt.After(now) {
+		return "", false
+	}
+
+	return token, true
+}
+
+func (s *Session) remove(name string) {
+	delete(s.Tokens, name)
+	delete(s.Storages, name)
+}
+
+// SessionStore keeps server side sessions by id
+type SessionStore interface {
+	Get(id string) (Session, bool, error)
+	Save(id string, s Session) error
+	Delete(id string) error
+	// RevokeStorage removes storage token from all sessions
+	RevokeStorage(storage string) error
+}
+
+// MemoryStore keeps sessions in memory, expired sessions are evicted periodically
+type MemoryStore struct {
+	mu        sync.Mutex
+	sessions  map[string]Session
+	nextSweep time.Time
+}
+
+// NewMemoryStore constructor for MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]Session),
+	}
+}
+
+func (ms *MemoryStore) Get(id string) (Session, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	s, ok := ms.sessions[id]
+	if !ok || s.expired(time.Now()) {
+		return Session{}, false, nil
+	}
+
+	return copySession(s), true, nil
+}
+
+func (ms *MemoryStore) Save(id string, s Session) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.sweep()
+	ms.sessions[id] = copySession(s)
+	return nil
+}
+
+func (ms *MemoryStore) Delete(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.sessions, id)
+	return nil
+}
+
+func (ms *MemoryStore) RevokeStorage(storage string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for id, s := range ms.sessions {
+		if _, ok := s.Tokens[storage]; !ok {
+			continue
+		}
+
+		s.remove(storage)
+		if len(s.Tokens) == 0 {
+			delete(ms.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+// sweep removes expired sessions not more often than sweepInterval, caller should hold the lock
+func (ms *MemoryStore) sweep() {
+	now := time.Now()
+	if now.Before(ms.nextSweep) {
+		return
+	}
+
+	for id, s := range ms.sessions {
+		if s.expired(now) {
+			delete(ms.sessions, id)
+		}
+	}
+	ms.nextSweep = now.Add(sweepInterval)
+}
+
+func copySession(s Session) Session {
+	tokens := make(map[string]string, len(s.Tokens))
+	for name, token := range s.Tokens {
+		tokens[name] = token
+	}
+
+	storages := make(map[string]StorageSession, len(s.Storages))
+	for name, st := range s.Storages {
+		storages[name] = st
+	}
+
+	return Session{
+		Tokens:    tokens,
+		Storages:  storages,
+		ExpiresAt: s.ExpiresAt,
+	}
+}
+
+// FileStore is MemoryStore persisted to the json file so sessions survive restarts
+type FileStore struct {
+	*MemoryStore
+	path string
+}
+
+// NewFileStore loads sessions from the file if it exists
+func NewFileStore(path string) (*FileStore, error) {
+	fs := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		path:        path,
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fs, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read sessions file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &fs.sessions); err != nil {
+		return nil, fmt.Errorf("decode sessions file: %w", err)
+	}
+
+	if fs.sessions == nil {
+		fs.sessions = make(map[string]Session)
+	}
+
+	return fs, nil
+}
+
+func (fs *FileStore) Save(id string, s Session) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.sweep()
+	fs.sessions[id] = copySession(s)
+	return fs.flush()
+}
+
+func (fs *FileStore) Delete(id string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	delete(fs.sessions, id)
+	return fs.flush()
+}
+
+func (fs *FileStore) RevokeStorage(storage string) error {
+	if err := fs.MemoryStore.RevokeStorage(storage); err != nil {
+		return err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.flush()
+}
+
+// flush writes all sessions to the file, caller should hold the lock
+func (fs *FileStore) flush() error {
+	return writeJSONFile(fs.path, fs.sessions)
+}
+
+// writeJSONFile writes value to the temporary file and renames it so the file is never partially written
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write temp file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temp file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename temp file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-web-service/internal/handler"
+)
+
+// MemoryShareStore keeps share links in memory, expired links are evicted periodically
+type MemoryShareStore struct {
+	mu        sync.Mutex
+	links     map[string]handler.ShareLink
+	nextSweep time.Time
+}
+
+// NewMemoryShareStore constructor for MemoryShareStore
+func NewMemoryShareStore() *MemoryShareStore {
+	return &MemoryShareStore{
+		links: make(map[string]handler.ShareLink),
+	}
+}
+
+func (ms *MemoryShareStore) Get(id string) (handler.ShareLink, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	l, ok := ms.links[id]
+	return l, ok, nil
+}
+
+func (ms *MemoryShareStore) List(storage string) ([]handler.ShareLink, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var links []handler.ShareLink
+	for _, l := range ms.links {
+		if l.Storage == storage {
+			links = append(links, l)
+		}
+	}
+
+	return links, nil
+}
+
+func (ms *MemoryShareStore) Save(l handler.ShareLink) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.sweep()
+	ms.links[l.ID] = l
+	return nil
+}
+
+func (ms *MemoryShareStore) Use(id string, now time.Time) (handler.ShareLink, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.use(id, now)
+}
+
+func (ms *MemoryShareStore) Delete(storage string, id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.delete(storage, id)
+	return nil
+}
+
+func (ms *MemoryShareStore) DeleteStorage(storage string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.deleteStorage(storage)
+	return nil
+}
+
+// use counts download, caller should hold the lock
+func (ms *MemoryShareStore) use(id string, now time.Time) (handler.ShareLink, error) {
+	l, ok := ms.links[id]
+	if !ok || !l.Available(now) {
+		return handler.ShareLink{}, handler.ErrShareLinkGone
+	}
+
+	l.Downloads++
+	ms.links[id] = l
+	return l, nil
+}
+
+// delete removes link only if it belongs to the storage, caller should hold the lock
+func (ms *MemoryShareStore) delete(storage string, id string) {
+	if l, ok := ms.links[id]; ok && l.Storage == storage {
+		delete(ms.links, id)
+	}
+}
+
+func (ms *MemoryShareStore) deleteStorage(storage string) {
+	for id, l := range ms.links {
+		if l.Storage == storage {
+			delete(ms.links, id)
+		}
+	}
+}
+
+// sweep removes expired links not more often than sweepInterval, caller should hold the lock
+func (ms *MemoryShareStore) sweep() {
+	now := time.Now()
+	if now.Before(ms.nextSweep) {
+		return
+	}
+
+	for id, l := range ms.links {
+		if l.Expired(now) {
+			delete(ms.links, id)
+		}
+	}
+	ms.nextSweep = now.Add(sweepInterval)
+}
+
+// FileShareStore is MemoryShareStore persisted to the json file so links and counters survive restarts
+// the file contains gateway tokens and should be readable by the service only
+type FileShareStore struct {
+	*MemoryShareStore
+	path string
+}
+
+// NewFileShareStore loads links from the file if it exists
+func NewFileShareStore(path string) (*FileShareStore, error) {
+	fs := &FileShareStore{
+		MemoryShareStore: NewMemoryShareStore(),
+		path:             path,
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fs, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read share links file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &fs.links); err != nil {
+		return nil, fmt.Errorf("decode share links file: %w", err)
+	}
+
+	if fs.links == nil {
+		fs.links = make(map[string]handler.ShareLink)
+	}
+
+	return fs, nil
+}
+
+func (fs *FileShareStore) Save(l handler.ShareLink) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.sweep()
+	fs.links[l.ID] = l
+	return writeJSONFile(fs.path, fs.links)
+}
+
+func (fs *FileShareStore) Use(id string, now time.Time) (handler.ShareLink, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	l, err := fs.use(id, now)
+	if err != nil {
+		return handler.ShareLink{}, err
+	}
+
+	if err := writeJSONFile(fs.path, fs.links); err != nil {
+		return handler.ShareLink{}, err
+	}
+	return l, nil
+}
+
+func (fs *FileShareStore) Delete(storage string, id string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.delete(storage, id)
+	return writeJSONFile(fs.path, fs.links)
+}
+
+func (fs *FileShareStore) DeleteStorage(storage string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.deleteStorage(storage)
+	return writeJSONFile(fs.path, fs.links)
+}